@@ -0,0 +1,92 @@
+package rofs
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/absfs/absfs"
+)
+
+// WithAppendOnly makes the subtrees rooted at dirs append-only, a mode
+// between read-only and writable meant for logs and audit trails: new files
+// and directories may be created and files may be appended to, but bytes that
+// have been written can never be overwritten, truncated, renamed or removed.
+// Refused operations fail with ErrAppendOnly.
+//
+// Inside an append-only subtree OpenFile accepts O_APPEND, and O_CREATE|O_EXCL
+// for new files, and refuses O_TRUNC and every other way of opening a file
+// for writing. Files opened with O_APPEND are positioned at their end. Writes
+// are only accepted at the end of the file, so WriteAt, and Write after a
+// Seek away from the end, fail. Truncate, Remove, RemoveAll, Rename, Symlink,
+// Chown, Lchown and Chtimes fail, and Chmod fails if it would add write
+// permission bits. Removing or renaming a directory above an append-only
+// subtree fails as well.
+//
+// Directories are anchored and checked like those given to WithWritable, and
+// the append-only restrictions also apply where an append-only subtree lies
+// inside a writable one or the view is a Switch or Freezer.
+func WithAppendOnly(dirs ...string) Option {
+	return func(o *options) {
+		o.pendingAppendOnly = append(o.pendingAppendOnly, dirs...)
+	}
+}
+
+// appendOnly reports whether either of lexical or real, the unresolved and
+// resolved paths of a name on the wrapped filesystem, lies in an append-only
+// subtree.
+func (f *FileSystem) appendOnly(lexical, real string) bool {
+	return len(f.opts.appendOnly) > 0 &&
+		(inTree(f.opts.appendOnly, lexical) || inTree(f.opts.appendOnly, real))
+}
+
+// holdsAppendOnly reports whether an append-only subtree is rooted at or below
+// either of lexical or real, so that removing or renaming the path would take
+// it along.
+func (f *FileSystem) holdsAppendOnly(lexical, real string) bool {
+	for _, dir := range f.opts.appendOnly {
+		for _, p := range []string{lexical, real} {
+			if dir == p || p == "/" || strings.HasPrefix(dir, p+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// appendAllowed reports whether the mutating operation op may be applied in
+// an append-only subtree. Opening and changing the mode of files are further
+// checked by OpenFile and Chmod.
+func appendAllowed(op string) bool {
+	return op == "open" || op == "mkdir" || op == "chmod"
+}
+
+// appendFlags reports whether flag opens a file in a way that cannot modify
+// data it already holds.
+func appendFlags(flag int) bool {
+	if flag&absfs.O_TRUNC != 0 {
+		return false
+	}
+	return flag&absfs.O_APPEND != 0 || flag&(absfs.O_CREATE|absfs.O_EXCL) == absfs.O_CREATE|absfs.O_EXCL
+}
+
+// addsWriteBits reports whether changing the mode of the file at real to mode
+// would grant write permission it does not have yet.
+func (f *FileSystem) addsWriteBits(real string, mode os.FileMode) (bool, error) {
+	info, err := f.fs.Stat(real)
+	if err != nil {
+		return false, err
+	}
+	return mode.Perm()&0222&^info.Mode().Perm() != 0, nil
+}
+
+// atEnd reports whether the next Write on an append-only file would start at
+// its end.
+func (f *File) atEnd() bool {
+	pos, err := f.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false
+	}
+	info, err := f.f.Stat()
+	return err == nil && pos == info.Size()
+}
@@ -0,0 +1,305 @@
+package rofs_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/ioutil"
+	"github.com/absfs/memfs"
+	"github.com/absfs/rofs"
+)
+
+func TestAppendOnly(t *testing.T) {
+	for _, b := range testBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			dir := path.Join(b.dir, "worm")
+			mustMkdirAll(t, b.fs, path.Join(dir, "logs"))
+			mustMkdirAll(t, b.fs, path.Join(dir, "tmp"))
+			const prefix = "2024-01-01 started\n"
+			logName := path.Join(dir, "logs", "app.log")
+			mustWrite(t, b.fs, logName, prefix)
+			if err := b.fs.Chmod(logName, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			rfs, err := rofs.NewFS(b.fs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			view, err := rfs.SubFS(dir, rofs.WithAppendOnly("logs"), rofs.WithWritable("tmp"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// checkPrefix fails the test unless the log still starts with
+			// prefix and returns its content.
+			checkPrefix := func(t *testing.T) string {
+				t.Helper()
+				data, err := ioutil.ReadFile(b.fs, logName)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.HasPrefix(string(data), prefix) {
+					t.Fatalf("existing content changed: %q", data)
+				}
+				return string(data)
+			}
+			isAppendOnly := func(t *testing.T, what string, err error) {
+				t.Helper()
+				if !errors.Is(err, rofs.ErrAppendOnly) {
+					t.Errorf("%s: got %v, want ErrAppendOnly", what, err)
+				}
+			}
+
+			t.Run("append", func(t *testing.T) {
+				f, err := view.OpenFile("/logs/app.log", os.O_RDWR|os.O_APPEND, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.Close()
+				if _, err := f.WriteString("entry 1\n"); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := f.Write([]byte("entry 2\n")); err != nil {
+					t.Fatal(err)
+				}
+
+				// reading is fine, writing after seeking back is not
+				if _, err := f.Seek(0, io.SeekStart); err != nil {
+					t.Fatal(err)
+				}
+				buf := make([]byte, len(prefix))
+				if _, err := io.ReadFull(f, buf); err != nil || string(buf) != prefix {
+					t.Errorf("read back: got %q, %v", buf, err)
+				}
+				_, err = f.Write([]byte("XXXX"))
+				isAppendOnly(t, "Write after Seek", err)
+				_, err = f.WriteString("XXXX")
+				isAppendOnly(t, "WriteString after Seek", err)
+				_, err = f.WriteAt([]byte("XXXX"), 0)
+				isAppendOnly(t, "WriteAt", err)
+				isAppendOnly(t, "File.Truncate", f.Truncate(0))
+
+				// seeking back to the end makes appending possible again
+				if _, err := f.Seek(0, io.SeekEnd); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := f.WriteString("entry 3\n"); err != nil {
+					t.Fatal(err)
+				}
+
+				if got, want := checkPrefix(t), prefix+"entry 1\nentry 2\nentry 3\n"; got != want {
+					t.Errorf("content: got %q, want %q", got, want)
+				}
+			})
+
+			t.Run("create exclusive", func(t *testing.T) {
+				f, err := view.OpenFile("/logs/new.log", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := f.WriteString("a"); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := f.WriteString("b"); err != nil {
+					t.Fatal(err)
+				}
+				_, err = f.WriteAt([]byte("X"), 0)
+				isAppendOnly(t, "WriteAt on new file", err)
+				f.Close()
+				if data, _ := ioutil.ReadFile(b.fs, path.Join(dir, "logs", "new.log")); string(data) != "ab" {
+					t.Errorf("new file: got %q", data)
+				}
+
+				_, err = view.OpenFile("/logs/new.log", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+				if !errors.Is(err, os.ErrExist) {
+					t.Errorf("O_EXCL on existing file: got %v", err)
+				}
+				if err := view.Mkdir("/logs/2024", 0755); err != nil {
+					t.Errorf("Mkdir: %v", err)
+				}
+			})
+
+			t.Run("rejected", func(t *testing.T) {
+				for _, tt := range []struct {
+					name string
+					flag int
+				}{
+					{"O_WRONLY", os.O_WRONLY},
+					{"O_RDWR", os.O_RDWR},
+					{"O_WRONLY|O_CREATE", os.O_WRONLY | os.O_CREATE},
+					{"O_WRONLY|O_TRUNC", os.O_WRONLY | os.O_TRUNC},
+					{"O_WRONLY|O_APPEND|O_TRUNC", os.O_WRONLY | os.O_APPEND | os.O_TRUNC},
+					{"O_RDONLY|O_TRUNC", os.O_RDONLY | os.O_TRUNC},
+				} {
+					_, err := view.OpenFile("/logs/app.log", tt.flag, 0644)
+					isAppendOnly(t, "OpenFile "+tt.name, err)
+				}
+				_, err := view.Create("/logs/app.log")
+				isAppendOnly(t, "Create", err)
+				isAppendOnly(t, "Truncate", view.Truncate("/logs/app.log", 0))
+				isAppendOnly(t, "Remove", view.Remove("/logs/app.log"))
+				isAppendOnly(t, "RemoveAll", view.RemoveAll("/logs"))
+				isAppendOnly(t, "Rename", view.Rename("/logs/app.log", "/logs/old.log"))
+				isAppendOnly(t, "Rename out", view.Rename("/logs/app.log", "/tmp/app.log"))
+				isAppendOnly(t, "Rename in", view.Rename("/tmp", "/logs/tmp"))
+				isAppendOnly(t, "Symlink", view.Symlink("app.log", "/logs/link"))
+				isAppendOnly(t, "Chmod +w", view.Chmod("/logs/app.log", 0666))
+				isAppendOnly(t, "Chtimes", view.Chtimes("/logs/app.log", time.Unix(0, 0), time.Unix(0, 0)))
+
+				var le *os.LinkError
+				if err := view.Rename("/logs/app.log", "/logs/old.log"); !errors.As(err, &le) || le.Op != "rename" {
+					t.Errorf("Rename error: got %#v", err)
+				}
+				if err := view.Chmod("/logs/app.log", 0444); err != nil {
+					t.Errorf("Chmod -w: %v", err)
+				}
+				checkPrefix(t)
+			})
+
+			t.Run("error matching", func(t *testing.T) {
+				for _, target := range []error{rofs.ErrAppendOnly, rofs.ErrReadOnly, os.ErrPermission, syscall.EPERM} {
+					if !errors.Is(rofs.ErrAppendOnly, target) {
+						t.Errorf("errors.Is(ErrAppendOnly, %v): expected true", target)
+					}
+				}
+				if errors.Is(rofs.ErrReadOnly, rofs.ErrAppendOnly) {
+					t.Error("ErrReadOnly should not match ErrAppendOnly")
+				}
+			})
+		})
+	}
+}
+
+func TestAppendOnlyAncestors(t *testing.T) {
+	for _, b := range testBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			dir := path.Join(b.dir, "worm-ancestors")
+			mustMkdirAll(t, b.fs, path.Join(dir, "out", "a", "logs"))
+			mustMkdirAll(t, b.fs, path.Join(dir, "out", "tmp"))
+			logName := path.Join(dir, "out", "a", "logs", "audit.log")
+			mustWrite(t, b.fs, logName, "entry\n")
+
+			rfs, err := rofs.NewFS(b.fs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			view, err := rfs.SubFS(dir, rofs.WithWritable("out"), rofs.WithAppendOnly("out/a/logs"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			sw, err := rofs.NewSwitch(b.fs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			swView, err := sw.SubFS(dir, rofs.WithAppendOnly("out/a/logs"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, v := range []struct {
+				name string
+				fs   *rofs.FileSystem
+			}{{"writable", view}, {"switch", swView}} {
+				for _, tt := range []struct {
+					name string
+					err  error
+				}{
+					{"RemoveAll parent", v.fs.RemoveAll("/out/a")},
+					{"RemoveAll grandparent", v.fs.RemoveAll("/out")},
+					{"Remove parent", v.fs.Remove("/out/a")},
+					{"Rename parent", v.fs.Rename("/out/a", "/out/b")},
+					{"Rename grandparent", v.fs.Rename("/out", "/moved")},
+				} {
+					if !errors.Is(tt.err, rofs.ErrAppendOnly) {
+						t.Errorf("%s: %s: got %v, want ErrAppendOnly", v.name, tt.name, tt.err)
+					}
+				}
+				if data, err := ioutil.ReadFile(b.fs, logName); err != nil || string(data) != "entry\n" {
+					t.Fatalf("%s: log changed: %q, %v", v.name, data, err)
+				}
+			}
+
+			if err := swView.RemoveAll("/"); !errors.Is(err, rofs.ErrAppendOnly) {
+				t.Errorf("switch: RemoveAll root: got %v, want ErrAppendOnly", err)
+			}
+			if err := view.RemoveAll("/out/tmp"); err != nil {
+				t.Errorf("RemoveAll of a sibling: %v", err)
+			}
+		})
+	}
+}
+
+func TestAppendOnlyThroughSymlink(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		open func(fs absfs.SymlinkFileSystem) (*rofs.FileSystem, error)
+	}{
+		{"switch", func(fs absfs.SymlinkFileSystem) (*rofs.FileSystem, error) {
+			sw, err := rofs.NewSwitch(fs, rofs.WithAppendOnly("/logs"))
+			if err != nil {
+				return nil, err
+			}
+			return sw.FileSystem, nil
+		}},
+		{"freezer", func(fs absfs.SymlinkFileSystem) (*rofs.FileSystem, error) {
+			z, err := rofs.NewFreezer(fs, rofs.WithAppendOnly("/logs"))
+			if err != nil {
+				return nil, err
+			}
+			return z.FileSystem, nil
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mfs, err := memfs.NewFS()
+			if err != nil {
+				t.Fatal(err)
+			}
+			mustMkdirAll(t, mfs, "/logs")
+			mustWrite(t, mfs, "/logs/audit.log", "entry\n")
+			if err := mfs.Symlink("/logs/audit.log", "/l"); err != nil {
+				t.Fatal(err)
+			}
+			if err := mfs.Symlink("/logs", "/dir"); err != nil {
+				t.Fatal(err)
+			}
+			view, err := tt.open(mfs)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = view.OpenFile("/l", os.O_WRONLY|os.O_TRUNC, 0)
+			if !errors.Is(err, rofs.ErrAppendOnly) {
+				t.Errorf("OpenFile O_TRUNC through a link: got %v, want ErrAppendOnly", err)
+			}
+			if err := view.Truncate("/l", 0); !errors.Is(err, rofs.ErrAppendOnly) {
+				t.Errorf("Truncate through a link: got %v, want ErrAppendOnly", err)
+			}
+			if err := view.Remove("/dir/audit.log"); !errors.Is(err, rofs.ErrAppendOnly) {
+				t.Errorf("Remove through a directory link: got %v, want ErrAppendOnly", err)
+			}
+			f, err := view.OpenFile("/l", os.O_WRONLY|os.O_APPEND, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.WriteString("more\n"); err != nil {
+				t.Errorf("append through a link: %v", err)
+			}
+			f.Close()
+			if data, err := ioutil.ReadFile(mfs, "/logs/audit.log"); err != nil || string(data) != "entry\nmore\n" {
+				t.Errorf("log = %q, %v", data, err)
+			}
+			// the link itself is not in the append-only subtree
+			if err := view.Remove("/l"); err != nil {
+				t.Errorf("Remove of the link: %v", err)
+			}
+		})
+	}
+}
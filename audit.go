@@ -0,0 +1,299 @@
+package rofs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/absfs/absfs"
+)
+
+// An AuditEntry describes an operation refused by a view.
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	Op   string    `json:"op"`
+
+	// Path is the absolute path the operation was refused for, as seen
+	// through the view. Target is the new path of a rename, or the target of
+	// a symbolic link.
+	Path   string `json:"path"`
+	Target string `json:"target,omitempty"`
+
+	// Flags holds the OpenFile flags of a refused open, such as
+	// "O_WRONLY|O_CREATE|O_TRUNC".
+	Flags string `json:"flags,omitempty"`
+
+	// Caller is the identity attached with ContextWithCaller to the context
+	// of the view, if any.
+	Caller string `json:"caller,omitempty"`
+
+	// Reason is the message of the error the operation failed with.
+	Reason string `json:"reason"`
+}
+
+// An AuditSink receives the operations refused by the views it is given to
+// with WithAudit. Audit may be called concurrently.
+type AuditSink interface {
+	Audit(e AuditEntry)
+}
+
+// WithAudit reports every operation the view refuses as read-only,
+// append-only, retained or sealed to sink. Operations that fail for other
+// reasons, such as a missing file, are not reported.
+func WithAudit(sink AuditSink) Option {
+	return func(o *options) {
+		o.audit = sink
+	}
+}
+
+type callerKey struct{}
+
+// ContextWithCaller returns a copy of ctx carrying the identity of the caller
+// on whose behalf operations are made. Views given the context with
+// FileSystem.WithContext record it in their audit entries.
+func ContextWithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// CallerFromContext returns the identity attached to ctx with
+// ContextWithCaller, or "".
+func CallerFromContext(ctx context.Context) string {
+	caller, _ := ctx.Value(callerKey{}).(string)
+	return caller
+}
+
+// audit reports err, the error of a refused operation, to the audit sink of
+// the view. flag holds the OpenFile flags of a refused open, or -1.
+func (f *FileSystem) audit(err error, flag int) {
+	e := AuditEntry{
+		Time:   f.opts.now().UTC(),
+		Caller: CallerFromContext(f.Context()),
+		Reason: underlying(err).Error(),
+	}
+	if flag >= 0 {
+		e.Flags = flagString(flag)
+	}
+	var pe *fs.PathError
+	var le *os.LinkError
+	switch {
+	case errors.As(err, &pe):
+		e.Op, e.Path = pe.Op, f.abs(pe.Path)
+	case errors.As(err, &le) && le.Op == "symlink":
+		e.Op, e.Path, e.Target = le.Op, f.abs(le.New), le.Old
+	case errors.As(err, &le):
+		e.Op, e.Path, e.Target = le.Op, f.abs(le.Old), f.abs(le.New)
+	}
+	f.opts.audit.Audit(e)
+}
+
+var flagNames = []struct {
+	flag int
+	name string
+}{
+	{absfs.O_APPEND, "O_APPEND"},
+	{absfs.O_CREATE, "O_CREATE"},
+	{absfs.O_EXCL, "O_EXCL"},
+	{absfs.O_SYNC, "O_SYNC"},
+	{absfs.O_TRUNC, "O_TRUNC"},
+}
+
+// flagString formats the OpenFile flags flag like "O_RDWR|O_CREATE".
+func flagString(flag int) string {
+	var names []string
+	switch flag & absfs.O_ACCESS {
+	case absfs.O_RDONLY:
+		names = append(names, "O_RDONLY")
+	case absfs.O_WRONLY:
+		names = append(names, "O_WRONLY")
+	case absfs.O_RDWR:
+		names = append(names, "O_RDWR")
+	}
+	rest := flag &^ absfs.O_ACCESS
+	for _, n := range flagNames {
+		if rest&n.flag != 0 {
+			names = append(names, n.name)
+			rest &^= n.flag
+		}
+	}
+	if rest != 0 {
+		names = append(names, fmt.Sprintf("%#x", rest))
+	}
+	return strings.Join(names, "|")
+}
+
+type slogAudit struct {
+	logger *slog.Logger
+}
+
+// NewSlogAudit returns an AuditSink that logs every entry to logger at
+// slog.LevelWarn. A nil logger stands for slog.Default().
+func NewSlogAudit(logger *slog.Logger) AuditSink {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return slogAudit{logger}
+}
+
+func (s slogAudit) Audit(e AuditEntry) {
+	attrs := []slog.Attr{slog.String("op", e.Op), slog.String("path", e.Path)}
+	if e.Target != "" {
+		attrs = append(attrs, slog.String("target", e.Target))
+	}
+	if e.Flags != "" {
+		attrs = append(attrs, slog.String("flags", e.Flags))
+	}
+	if e.Caller != "" {
+		attrs = append(attrs, slog.String("caller", e.Caller))
+	}
+	attrs = append(attrs, slog.String("reason", e.Reason))
+	s.logger.LogAttrs(context.Background(), slog.LevelWarn, "rofs: operation denied", attrs...)
+}
+
+// ErrAuditTampered is reported by VerifyAuditLog for an audit log that was
+// modified after it was written.
+var ErrAuditTampered = errors.New("audit log entry does not match its chain")
+
+// AuditLog is an AuditSink appending the entries as lines of JSON to a file.
+// Each line carries the SHA-256 hash of the previous line's hash and its own
+// entry, so that modifying, inserting or removing an entry anywhere but at
+// the end of the file breaks the chain, which VerifyAuditLog detects.
+type AuditLog struct {
+	mu   sync.Mutex
+	file absfs.File
+	prev string
+	err  error
+}
+
+// auditRecord is a line of an AuditLog.
+type auditRecord struct {
+	AuditEntry
+	Prev string `json:"prev"`
+	Hash string `json:"hash"`
+}
+
+// OpenAuditLog opens the audit log name on fsys, creating it if needed. New
+// entries continue the chain of the existing ones.
+func OpenAuditLog(fsys absfs.FileSystem, name string) (*AuditLog, error) {
+	l := new(AuditLog)
+	data, err := fsys.ReadFile(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if data = bytes.TrimRight(data, "\n"); len(data) > 0 {
+		last := data[bytes.LastIndexByte(data, '\n')+1:]
+		var r auditRecord
+		if err := json.Unmarshal(last, &r); err != nil {
+			return nil, fmt.Errorf("rofs: audit log %s: %w", name, err)
+		}
+		l.prev = r.Hash
+	}
+	l.file, err = fsys.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Audit appends e to the log and syncs it. Failures are kept for Err.
+func (l *AuditLog) Audit(e AuditEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		l.fail(fs.ErrClosed)
+		return
+	}
+	r := auditRecord{AuditEntry: e, Prev: l.prev}
+	var err error
+	if r.Hash, err = chainHash(r.Prev, e); err != nil {
+		l.fail(err)
+		return
+	}
+	line, err := json.Marshal(r)
+	if err != nil {
+		l.fail(err)
+		return
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		l.fail(err)
+		return
+	}
+	l.prev = r.Hash
+	l.fail(l.file.Sync())
+}
+
+func (l *AuditLog) fail(err error) {
+	if l.err == nil {
+		l.err = err
+	}
+}
+
+// Err returns the first error met while writing entries, if any.
+func (l *AuditLog) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Close closes the log file. Entries audited afterwards are lost.
+func (l *AuditLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// chainHash returns the hash of the entry e following the entry with hash
+// prev.
+func chainHash(prev string, e AuditEntry) (string, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write([]byte(prev))
+	h.Write([]byte{'\n'})
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// VerifyAuditLog checks the hash chain of the audit log name on fsys. It
+// returns an error wrapping ErrAuditTampered and naming the first line that
+// does not match, or nil if the whole log is intact.
+func VerifyAuditLog(fsys absfs.FileSystem, name string) error {
+	data, err := fsys.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	prev := ""
+	for n := 1; len(data) > 0; n++ {
+		var line []byte
+		line, data, _ = bytes.Cut(data, []byte("\n"))
+		var r auditRecord
+		if err := json.Unmarshal(line, &r); err != nil {
+			return fmt.Errorf("rofs: audit log %s, line %d: %w: %v", name, n, ErrAuditTampered, err)
+		}
+		hash, err := chainHash(r.Prev, r.AuditEntry)
+		if err != nil {
+			return err
+		}
+		if r.Prev != prev || r.Hash != hash {
+			return fmt.Errorf("rofs: audit log %s, line %d: %w", name, n, ErrAuditTampered)
+		}
+		prev = r.Hash
+	}
+	return nil
+}
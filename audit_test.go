@@ -0,0 +1,173 @@
+package rofs_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/absfs/memfs"
+	"github.com/absfs/rofs"
+)
+
+// auditRecorder is an AuditSink keeping the entries in memory.
+type auditRecorder struct {
+	mu      sync.Mutex
+	entries []rofs.AuditEntry
+}
+
+func (r *auditRecorder) Audit(e rofs.AuditEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, e)
+}
+
+func TestAudit(t *testing.T) {
+	for _, b := range testBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			dir := path.Join(b.dir, "audit")
+			mustMkdirAll(t, b.fs, path.Join(dir, "out"))
+			mustWrite(t, b.fs, path.Join(dir, "conf"), "conf")
+
+			now := time.Date(2024, 3, 1, 9, 30, 0, 0, time.FixedZone("CET", 3600))
+			rec := new(auditRecorder)
+			rfs, err := rofs.NewFS(b.fs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			view, err := rfs.SubFS(dir,
+				rofs.WithWritable("out"),
+				rofs.WithAudit(rec),
+				rofs.WithClock(func() time.Time { return now }))
+			if err != nil {
+				t.Fatal(err)
+			}
+			view = view.WithContext(rofs.ContextWithCaller(context.Background(), "build-42"))
+
+			// allowed and failed-but-not-denied operations are not audited
+			mustWrite(t, view, "/out/bin", "bin")
+			if _, err := view.ReadFile("/conf"); err != nil {
+				t.Fatal(err)
+			}
+			if err := view.Remove("/out/missing"); !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("Remove of a missing file: %v", err)
+			}
+
+			if _, err := view.OpenFile("conf", os.O_WRONLY|os.O_TRUNC, 0); err == nil {
+				t.Fatal("OpenFile succeeded")
+			}
+			if err := view.Rename("/conf", "/out/conf"); err == nil {
+				t.Fatal("Rename succeeded")
+			}
+			if err := view.Symlink("conf", "/link"); err == nil {
+				t.Fatal("Symlink succeeded")
+			}
+			f, err := view.Open("/conf")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if _, err := f.Write([]byte("x")); err == nil {
+				t.Fatal("Write succeeded")
+			}
+
+			at := now.UTC()
+			want := []rofs.AuditEntry{
+				{Time: at, Op: "open", Path: "/conf", Flags: "O_WRONLY|O_TRUNC", Caller: "build-42", Reason: "read-only file system"},
+				{Time: at, Op: "rename", Path: "/conf", Target: "/out/conf", Caller: "build-42", Reason: "read-only file system"},
+				{Time: at, Op: "symlink", Path: "/link", Target: "conf", Caller: "build-42", Reason: "read-only file system"},
+				{Time: at, Op: "write", Path: "/conf", Caller: "build-42", Reason: "read-only file system"},
+			}
+			if !reflect.DeepEqual(rec.entries, want) {
+				t.Errorf("audit entries:\ngot  %+v\nwant %+v", rec.entries, want)
+			}
+		})
+	}
+}
+
+func TestAuditSlog(t *testing.T) {
+	mfs, err := memfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	rfs, err := rofs.NewFS(mfs, rofs.WithAudit(rofs.NewSlogAudit(slog.New(slog.NewTextHandler(&buf, nil)))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rfs.WithContext(rofs.ContextWithCaller(context.Background(), "alice")).Mkdir("/tmp", 0755); err == nil {
+		t.Fatal("Mkdir succeeded")
+	}
+	out := buf.String()
+	for _, want := range []string{"level=WARN", "op=mkdir", "path=/tmp", "caller=alice", `reason="read-only file system"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log output %q lacks %q", out, want)
+		}
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	mfs, err := memfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs, err := memfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	deny := func(names ...string) {
+		t.Helper()
+		log, err := rofs.OpenAuditLog(logs, "/audit.jsonl")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rfs, err := rofs.NewFS(mfs, rofs.WithAudit(log))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range names {
+			if err := rfs.Mkdir(name, 0755); err == nil {
+				t.Fatalf("Mkdir %s succeeded", name)
+			}
+		}
+		if err := log.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if err := log.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deny("/a", "/b", "/c")
+	// the chain continues across restarts
+	deny("/d")
+	if err := rofs.VerifyAuditLog(logs, "/audit.jsonl"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := logs.ReadFile("/audit.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if len(lines) != 5 || lines[4] != "" {
+		t.Fatalf("audit log has %d lines:\n%s", len(lines)-1, data)
+	}
+	for name, tampered := range map[string]string{
+		"edited":    lines[0] + strings.Replace(lines[1], `"/b"`, `"/B"`, 1) + lines[2] + lines[3],
+		"removed":   lines[0] + lines[2] + lines[3],
+		"reordered": lines[0] + lines[2] + lines[1] + lines[3],
+	} {
+		mustWrite(t, logs, "/tampered.jsonl", tampered)
+		err := rofs.VerifyAuditLog(logs, "/tampered.jsonl")
+		if !errors.Is(err, rofs.ErrAuditTampered) || !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("%s: got %v, want ErrAuditTampered at line 2", name, err)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package rofs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/absfs/absfs"
+)
+
+// NewFromFileSystem returns a read-only view of fs. If fs also implements
+// absfs.SymLinker this is the same as NewFS. Otherwise the view has no
+// symbolic links: Lstat behaves like Stat, and Readlink fails with
+// ErrNotSupported.
+func NewFromFileSystem(fs absfs.FileSystem, opts ...Option) (*FileSystem, error) {
+	if sfs, ok := fs.(absfs.SymlinkFileSystem); ok {
+		return NewFS(sfs, opts...)
+	}
+	return NewFS(&noSymlinks{fs}, opts...)
+}
+
+// NewFromFiler returns a read-only view of filer. The methods of
+// absfs.FileSystem that filer lacks are supplied by absfs.ExtendFiler, and
+// symbolic links are handled as described for NewFromFileSystem.
+func NewFromFiler(filer absfs.Filer, opts ...Option) (*FileSystem, error) {
+	if fs, ok := filer.(absfs.FileSystem); ok {
+		return NewFromFileSystem(fs, opts...)
+	}
+	// absfs.ExtendFiler always adds symlink methods, which fail when filer
+	// has none of its own, so only keep them if filer really has them.
+	fs := absfs.ExtendFiler(filer)
+	if _, ok := filer.(absfs.SymLinker); ok {
+		return NewFromFileSystem(fs, opts...)
+	}
+	return NewFS(&noSymlinks{fs}, opts...)
+}
+
+// NewFromIOFS returns a read-only view of an io/fs filesystem such as an
+// embed.FS. The root of fsys appears as "/" in the view. If fsys provides
+// ReadLink and Lstat methods, as fs.ReadLinkFS does, symbolic links are
+// reported; otherwise they behave as described for NewFromFileSystem.
+// Seek and ReadAt on files that do not support them fail with
+// ErrNotSupported.
+func NewFromIOFS(fsys fs.FS, opts ...Option) (*FileSystem, error) {
+	return NewFS(&ioBackend{fsys}, opts...)
+}
+
+// noSymlinks adds symlink methods to a FileSystem that has none.
+type noSymlinks struct {
+	absfs.FileSystem
+}
+
+func (n *noSymlinks) Lstat(name string) (os.FileInfo, error) {
+	return n.FileSystem.Stat(name)
+}
+
+func (n *noSymlinks) Lchown(name string, uid, gid int) error {
+	return &os.PathError{Op: "lchown", Path: name, Err: ErrNotSupported}
+}
+
+func (n *noSymlinks) Readlink(name string) (string, error) {
+	return "", &os.PathError{Op: "readlink", Path: name, Err: ErrNotSupported}
+}
+
+func (n *noSymlinks) Symlink(oldname, newname string) error {
+	return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: ErrNotSupported}
+}
+
+// linkReader is implemented by io/fs filesystems that expose symbolic links.
+// It matches fs.ReadLinkFS, which is newer than this module's minimum Go
+// version.
+type linkReader interface {
+	ReadLink(name string) (string, error)
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+// ioBackend adapts an fs.FS to absfs.SymlinkFileSystem. All paths it receives
+// are absolute; they are mapped to io/fs names by stripping the leading
+// slash. Every mutating method fails with ErrReadOnly.
+type ioBackend struct {
+	fsys fs.FS
+}
+
+// ioName maps an absolute absfs path to an io/fs name.
+func ioName(name string) string {
+	name = path.Clean("/" + name)
+	if name == "/" {
+		return "."
+	}
+	return name[1:]
+}
+
+func (b *ioBackend) OpenFile(name string, flag int, perm os.FileMode) (absfs.File, error) {
+	if flag&absfs.O_ACCESS != os.O_RDONLY || flag&writeFlags != 0 {
+		return nil, readOnly("open", name)
+	}
+	f, err := b.fsys.Open(ioName(name))
+	if err != nil {
+		return nil, pathErr(err, name)
+	}
+	return &ioFile{f: f, name: name}, nil
+}
+
+func (b *ioBackend) Open(name string) (absfs.File, error) {
+	return b.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (b *ioBackend) Stat(name string) (os.FileInfo, error) {
+	info, err := fs.Stat(b.fsys, ioName(name))
+	return info, pathErr(err, name)
+}
+
+func (b *ioBackend) Lstat(name string) (os.FileInfo, error) {
+	if lr, ok := b.fsys.(linkReader); ok {
+		info, err := lr.Lstat(ioName(name))
+		return info, pathErr(err, name)
+	}
+	return b.Stat(name)
+}
+
+func (b *ioBackend) Readlink(name string) (string, error) {
+	if lr, ok := b.fsys.(linkReader); ok {
+		target, err := lr.ReadLink(ioName(name))
+		return target, pathErr(err, name)
+	}
+	return "", &os.PathError{Op: "readlink", Path: name, Err: ErrNotSupported}
+}
+
+func (b *ioBackend) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(b.fsys, ioName(name))
+	return entries, pathErr(err, name)
+}
+
+func (b *ioBackend) ReadFile(name string) ([]byte, error) {
+	data, err := fs.ReadFile(b.fsys, ioName(name))
+	return data, pathErr(err, name)
+}
+
+func (b *ioBackend) Sub(dir string) (fs.FS, error) {
+	return fs.Sub(b.fsys, ioName(dir))
+}
+
+func (b *ioBackend) Chdir(dir string) error {
+	return &os.PathError{Op: "chdir", Path: dir, Err: ErrNotSupported}
+}
+
+func (b *ioBackend) Getwd() (string, error) {
+	return "/", nil
+}
+
+func (b *ioBackend) TempDir() string {
+	return "/tmp"
+}
+
+func (b *ioBackend) Create(name string) (absfs.File, error) {
+	return nil, readOnly("open", name)
+}
+
+func (b *ioBackend) Mkdir(name string, perm os.FileMode) error {
+	return readOnly("mkdir", name)
+}
+
+func (b *ioBackend) MkdirAll(name string, perm os.FileMode) error {
+	return readOnly("mkdir", name)
+}
+
+func (b *ioBackend) Remove(name string) error {
+	return readOnly("remove", name)
+}
+
+func (b *ioBackend) RemoveAll(name string) error {
+	return readOnly("removeall", name)
+}
+
+func (b *ioBackend) Rename(oldpath, newpath string) error {
+	return readOnlyLink("rename", oldpath, newpath)
+}
+
+func (b *ioBackend) Chmod(name string, mode os.FileMode) error {
+	return readOnly("chmod", name)
+}
+
+func (b *ioBackend) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return readOnly("chtimes", name)
+}
+
+func (b *ioBackend) Chown(name string, uid, gid int) error {
+	return readOnly("chown", name)
+}
+
+func (b *ioBackend) Lchown(name string, uid, gid int) error {
+	return readOnly("lchown", name)
+}
+
+func (b *ioBackend) Truncate(name string, size int64) error {
+	return readOnly("truncate", name)
+}
+
+func (b *ioBackend) Symlink(oldname, newname string) error {
+	return readOnlyLink("symlink", oldname, newname)
+}
+
+// ioFile adapts an fs.File to absfs.File.
+type ioFile struct {
+	f    fs.File
+	name string
+}
+
+func (f *ioFile) Name() string {
+	return f.name
+}
+
+func (f *ioFile) Read(p []byte) (int, error) {
+	return f.f.Read(p)
+}
+
+func (f *ioFile) ReadAt(b []byte, off int64) (int, error) {
+	if ra, ok := f.f.(io.ReaderAt); ok {
+		return ra.ReadAt(b, off)
+	}
+	return 0, &os.PathError{Op: "readat", Path: f.name, Err: ErrNotSupported}
+}
+
+func (f *ioFile) Seek(offset int64, whence int) (int64, error) {
+	if s, ok := f.f.(io.Seeker); ok {
+		return s.Seek(offset, whence)
+	}
+	return 0, &os.PathError{Op: "seek", Path: f.name, Err: ErrNotSupported}
+}
+
+func (f *ioFile) Write(p []byte) (int, error) {
+	return 0, readOnly("write", f.name)
+}
+
+func (f *ioFile) WriteAt(b []byte, off int64) (int, error) {
+	return 0, readOnly("write", f.name)
+}
+
+func (f *ioFile) WriteString(s string) (int, error) {
+	return 0, readOnly("write", f.name)
+}
+
+func (f *ioFile) Truncate(size int64) error {
+	return readOnly("truncate", f.name)
+}
+
+func (f *ioFile) Close() error {
+	return f.f.Close()
+}
+
+func (f *ioFile) Sync() error {
+	return nil
+}
+
+func (f *ioFile) Stat() (os.FileInfo, error) {
+	return f.f.Stat()
+}
+
+func (f *ioFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	d, ok := f.f.(fs.ReadDirFile)
+	if !ok {
+		return nil, &os.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+	}
+	return d.ReadDir(n)
+}
+
+func (f *ioFile) Readdir(n int) ([]os.FileInfo, error) {
+	entries, err := f.ReadDir(n)
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		info, ierr := e.Info()
+		if ierr != nil {
+			return infos, ierr
+		}
+		infos = append(infos, info)
+	}
+	return infos, err
+}
+
+func (f *ioFile) Readdirnames(n int) ([]string, error) {
+	entries, err := f.ReadDir(n)
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+	return names, err
+}
@@ -0,0 +1,208 @@
+package rofs_test
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"syscall"
+	"testing"
+	"testing/fstest"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/memfs"
+	"github.com/absfs/rofs"
+)
+
+// plainFS hides the symlink methods of a backend.
+type plainFS struct {
+	absfs.FileSystem
+}
+
+// plainFiler hides everything but the absfs.Filer methods of a backend.
+type plainFiler struct {
+	absfs.Filer
+}
+
+func TestConstructors(t *testing.T) {
+	_, wfs := setupTestFS(t)
+
+	// Backends without symlink support are given a tree without links.
+	plain, err := memfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustMkdirAll(t, plain, "/testdir/subdir")
+	mustWrite(t, plain, "/testdir/file.txt", "test content")
+	mustWrite(t, plain, "/testdir/subdir/nested.txt", "nested content")
+
+	mapfs := fstest.MapFS{
+		"testdir/file.txt":          {Data: []byte("test content"), Mode: 0644},
+		"testdir/subdir/nested.txt": {Data: []byte("nested content"), Mode: 0644},
+	}
+
+	views := []struct {
+		name     string
+		symlinks bool
+		new      func() (*rofs.FileSystem, error)
+	}{
+		{"NewFS", true, func() (*rofs.FileSystem, error) { return rofs.NewFS(wfs) }},
+		{"NewFromFileSystem symlinks", true, func() (*rofs.FileSystem, error) { return rofs.NewFromFileSystem(wfs) }},
+		{"NewFromFileSystem", false, func() (*rofs.FileSystem, error) { return rofs.NewFromFileSystem(plainFS{plain}) }},
+		{"NewFromFiler", false, func() (*rofs.FileSystem, error) { return rofs.NewFromFiler(plainFiler{plain}) }},
+		{"NewFromIOFS", false, func() (*rofs.FileSystem, error) { return rofs.NewFromIOFS(onlyFS{mapfs}) }},
+	}
+
+	for _, v := range views {
+		t.Run(v.name, func(t *testing.T) {
+			rfs, err := v.new()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := rfs.Chdir("/"); err != nil {
+				t.Fatal(err)
+			}
+
+			t.Run("reads", func(t *testing.T) {
+				data, err := rfs.ReadFile("/testdir/file.txt")
+				if err != nil || string(data) != "test content" {
+					t.Errorf("ReadFile: got %q, %v", data, err)
+				}
+
+				f, err := rfs.Open("testdir/subdir/nested.txt")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.Close()
+				if f.Name() != "/testdir/subdir/nested.txt" {
+					t.Errorf("Name: got %q", f.Name())
+				}
+				buf := make([]byte, 7)
+				if _, err := f.ReadAt(buf, 7); err != nil && err != io.EOF {
+					t.Fatal(err)
+				}
+				if string(buf) != "content" {
+					t.Errorf("ReadAt: got %q", buf)
+				}
+				if pos, err := f.Seek(-7, io.SeekEnd); err != nil || pos != 7 {
+					t.Errorf("Seek: got %d, %v", pos, err)
+				}
+
+				entries, err := rfs.ReadDir("/testdir")
+				if err != nil {
+					t.Fatal(err)
+				}
+				names := map[string]bool{}
+				for _, e := range entries {
+					names[e.Name()] = true
+				}
+				if !names["file.txt"] || !names["subdir"] {
+					t.Errorf("ReadDir: got %v", names)
+				}
+
+				dir, err := rfs.Open("/testdir")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer dir.Close()
+				dirnames, err := dir.Readdirnames(-1)
+				if err != nil || len(dirnames) < 2 {
+					t.Errorf("Readdirnames: got %v, %v", dirnames, err)
+				}
+
+				if _, err := rfs.Stat("/missing"); !errors.Is(err, fs.ErrNotExist) {
+					t.Errorf("Stat missing: expected fs.ErrNotExist, got %v", err)
+				}
+			})
+
+			t.Run("writes are denied", func(t *testing.T) {
+				if _, err := rfs.OpenFile("/testdir/file.txt", os.O_RDWR, 0); !errors.Is(err, rofs.ErrReadOnly) {
+					t.Errorf("OpenFile: expected ErrReadOnly, got %v", err)
+				}
+				if err := rfs.Mkdir("/new", 0755); !errors.Is(err, rofs.ErrReadOnly) {
+					t.Errorf("Mkdir: expected ErrReadOnly, got %v", err)
+				}
+				if err := rfs.Symlink("/testdir/file.txt", "/l"); !errors.Is(err, rofs.ErrReadOnly) {
+					t.Errorf("Symlink: expected ErrReadOnly, got %v", err)
+				}
+			})
+
+			t.Run("symlinks", func(t *testing.T) {
+				if v.symlinks {
+					target, err := rfs.Readlink("/testdir/link.txt")
+					if err != nil || target != "/testdir/file.txt" {
+						t.Errorf("Readlink: got %q, %v", target, err)
+					}
+					return
+				}
+
+				_, err := rfs.Readlink("/testdir/file.txt")
+				if !errors.Is(err, rofs.ErrNotSupported) {
+					t.Errorf("Readlink: expected ErrNotSupported, got %v", err)
+				}
+				if !errors.Is(err, errors.ErrUnsupported) || !errors.Is(err, syscall.ENOTSUP) {
+					t.Errorf("Readlink: expected ErrUnsupported and ENOTSUP, got %v", err)
+				}
+
+				info, err := rfs.Lstat("/testdir/file.txt")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Name() != "file.txt" || info.IsDir() {
+					t.Errorf("Lstat: got %s %s", info.Name(), info.Mode())
+				}
+			})
+
+			t.Run("io/fs", func(t *testing.T) {
+				if err := fstest.TestFS(rfs.IOFS(), "testdir/file.txt", "testdir/subdir/nested.txt"); err != nil {
+					t.Fatal(err)
+				}
+			})
+		})
+	}
+}
+
+// onlyFS hides every method of an fs.FS except Open.
+type onlyFS struct {
+	fs.FS
+}
+
+// noSeekFS serves files that implement neither io.Seeker nor io.ReaderAt.
+type noSeekFS struct {
+	fs.FS
+}
+
+type noSeekFile struct {
+	fs.File
+}
+
+func (n noSeekFS) Open(name string) (fs.File, error) {
+	f, err := n.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return noSeekFile{f}, nil
+}
+
+func TestNewFromIOFSWithoutSeek(t *testing.T) {
+	rfs, err := rofs.NewFromIOFS(noSeekFS{fstest.MapFS{"a.txt": {Data: []byte("alpha")}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := rfs.Open("/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil || string(data) != "alpha" {
+		t.Errorf("ReadAll: got %q, %v", data, err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); !errors.Is(err, rofs.ErrNotSupported) {
+		t.Errorf("Seek: expected ErrNotSupported, got %v", err)
+	}
+	if _, err := f.ReadAt(make([]byte, 1), 0); !errors.Is(err, rofs.ErrNotSupported) {
+		t.Errorf("ReadAt: expected ErrNotSupported, got %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package rofs
+
+import (
+	"strings"
+
+	"github.com/absfs/absfs"
+)
+
+// A Capability is a set of mutating operations, used by WithCapabilities to
+// choose which of them a view lets through.
+type Capability uint16
+
+const (
+	// CapWrite covers writing to files: opening them for writing or with
+	// O_APPEND, and Write, WriteAt and WriteString on the open file.
+	CapWrite Capability = 1 << iota
+	// CapCreate covers creating files with O_CREATE.
+	CapCreate
+	// CapMkdir covers Mkdir and MkdirAll.
+	CapMkdir
+	// CapRemove covers Remove and RemoveAll.
+	CapRemove
+	// CapRename covers Rename.
+	CapRename
+	// CapChmod covers Chmod.
+	CapChmod
+	// CapChown covers Chown and Lchown.
+	CapChown
+	// CapChtimes covers Chtimes.
+	CapChtimes
+	// CapTruncate covers Truncate, on the filesystem and on open files, and
+	// opening files with O_TRUNC.
+	CapTruncate
+	// CapSymlink covers Symlink.
+	CapSymlink
+
+	// CapNone is the empty set, which leaves a view fully read-only.
+	CapNone Capability = 0
+	// CapAll holds every capability.
+	CapAll = CapWrite | CapCreate | CapMkdir | CapRemove | CapRename |
+		CapChmod | CapChown | CapChtimes | CapTruncate | CapSymlink
+)
+
+var capNames = []string{
+	"write", "create", "mkdir", "remove", "rename",
+	"chmod", "chown", "chtimes", "truncate", "symlink",
+}
+
+// String returns the names of the capabilities in c separated by "|", such
+// as "chmod|chtimes", or "none" for the empty set.
+func (c Capability) String() string {
+	if c == CapNone {
+		return "none"
+	}
+	var names []string
+	for i, name := range capNames {
+		if c&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// WithCapabilities lets the operations in caps through everywhere in the
+// view, while every other mutating operation keeps failing with ErrReadOnly
+// outside the writable subtrees. It allows, for instance, Chtimes for
+// make-style tooling, or Chmod while file contents stay frozen:
+//
+//	rofs.NewFS(backend, rofs.WithCapabilities(rofs.CapChtimes))
+//
+// The default, CapNone, keeps the view fully read-only. Inside writable
+// subtrees, and in views that forward every operation such as an unlocked
+// Switch, all operations are allowed regardless of caps. Rules, append-only
+// subtrees, retention and sealing still apply to the operations let through.
+func WithCapabilities(caps Capability) Option {
+	return func(o *options) {
+		o.caps = caps & CapAll
+	}
+}
+
+// Capabilities returns the operations the view lets through outside its
+// writable subtrees, as set by WithCapabilities.
+func (f *FileSystem) Capabilities() Capability {
+	return f.opts.caps
+}
+
+// granted reports whether the view lets every operation in need through
+// outside the writable subtrees.
+func (f *FileSystem) granted(need Capability) bool {
+	return need != CapNone && f.opts.caps&need == need
+}
+
+// openCaps returns the capabilities OpenFile needs for flag. O_CREATE without
+// O_EXCL only needs CapCreate if name does not exist yet.
+func (f *FileSystem) openCaps(name string, flag int) Capability {
+	var need Capability
+	if flag&absfs.O_ACCESS != absfs.O_RDONLY || flag&absfs.O_APPEND != 0 {
+		need |= CapWrite
+	}
+	if flag&absfs.O_TRUNC != 0 {
+		need |= CapTruncate
+	}
+	if flag&absfs.O_CREATE != 0 {
+		need |= CapCreate
+		if flag&absfs.O_EXCL == 0 && f.opts.caps != CapNone && !f.granted(CapCreate) {
+			if real, err := f.locate("open", name, true); err == nil {
+				if _, err := f.fs.Stat(real); err == nil {
+					need &^= CapCreate
+				}
+			}
+		}
+	}
+	if need == CapNone {
+		// O_EXCL alone creates nothing, but is refused like any other
+		// write flag
+		need = CapCreate
+	}
+	return need
+}
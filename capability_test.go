@@ -0,0 +1,198 @@
+package rofs_test
+
+import (
+	"errors"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/ioutil"
+	"github.com/absfs/rofs"
+)
+
+func TestCapabilities(t *testing.T) {
+	ops := []struct {
+		cap rofs.Capability
+		op  string
+		do  func(fs absfs.SymlinkFileSystem) error
+	}{
+		{rofs.CapWrite, "write", func(fs absfs.SymlinkFileSystem) error {
+			f, err := fs.OpenFile("/file", os.O_WRONLY, 0)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = f.WriteString("F")
+			return err
+		}},
+		{rofs.CapCreate, "create", func(fs absfs.SymlinkFileSystem) error {
+			f, err := fs.OpenFile("/new", os.O_RDONLY|os.O_CREATE, 0644)
+			if err != nil {
+				return err
+			}
+			return f.Close()
+		}},
+		{rofs.CapMkdir, "mkdir", func(fs absfs.SymlinkFileSystem) error {
+			return fs.Mkdir("/newdir", 0755)
+		}},
+		{rofs.CapMkdir, "mkdirall", func(fs absfs.SymlinkFileSystem) error {
+			return fs.MkdirAll("/a/b", 0755)
+		}},
+		{rofs.CapRemove, "remove", func(fs absfs.SymlinkFileSystem) error {
+			return fs.Remove("/victim")
+		}},
+		{rofs.CapRemove, "removeall", func(fs absfs.SymlinkFileSystem) error {
+			return fs.RemoveAll("/dir")
+		}},
+		{rofs.CapRename, "rename", func(fs absfs.SymlinkFileSystem) error {
+			return fs.Rename("/moved", "/moved.bak")
+		}},
+		{rofs.CapChmod, "chmod", func(fs absfs.SymlinkFileSystem) error {
+			return fs.Chmod("/file", 0600)
+		}},
+		{rofs.CapChown, "chown", func(fs absfs.SymlinkFileSystem) error {
+			return fs.Chown("/file", os.Getuid(), os.Getgid())
+		}},
+		{rofs.CapChown, "lchown", func(fs absfs.SymlinkFileSystem) error {
+			return fs.Lchown("/file", os.Getuid(), os.Getgid())
+		}},
+		{rofs.CapChtimes, "chtimes", func(fs absfs.SymlinkFileSystem) error {
+			return fs.Chtimes("/file", time.Now(), time.Now())
+		}},
+		{rofs.CapTruncate, "truncate", func(fs absfs.SymlinkFileSystem) error {
+			return fs.Truncate("/file", 2)
+		}},
+		{rofs.CapSymlink, "symlink", func(fs absfs.SymlinkFileSystem) error {
+			return fs.Symlink("file", "/link")
+		}},
+	}
+
+	for _, b := range testBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			for _, grant := range ops {
+				dir := path.Join(b.dir, "caps-"+grant.op)
+				mustMkdirAll(t, b.fs, path.Join(dir, "dir", "sub"))
+				mustWrite(t, b.fs, path.Join(dir, "file"), "file")
+				mustWrite(t, b.fs, path.Join(dir, "victim"), "victim")
+				mustWrite(t, b.fs, path.Join(dir, "moved"), "moved")
+				rfs, err := rofs.NewFS(b.fs)
+				if err != nil {
+					t.Fatal(err)
+				}
+				view, err := rfs.SubFS(dir, rofs.WithCapabilities(grant.cap))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := view.Capabilities(); got != grant.cap {
+					t.Errorf("Capabilities() = %v, want %v", got, grant.cap)
+				}
+
+				for _, op := range ops {
+					err := op.do(view)
+					switch {
+					case op.cap == grant.cap && err != nil:
+						t.Errorf("%v: %s failed: %v", grant.cap, op.op, err)
+					case op.cap != grant.cap && !errors.Is(err, rofs.ErrReadOnly):
+						t.Errorf("%v: %s: got %v, want ErrReadOnly", grant.cap, op.op, err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCapabilitiesOpenFile(t *testing.T) {
+	for _, b := range testBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			dir := path.Join(b.dir, "caps-open")
+			mustMkdirAll(t, b.fs, dir)
+			mustWrite(t, b.fs, path.Join(dir, "conf"), "old content")
+			rfs, err := rofs.NewFS(b.fs)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// content may be rewritten, but nothing created
+			view, err := rfs.SubFS(dir, rofs.WithCapabilities(rofs.CapWrite|rofs.CapTruncate))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(view, "/conf", []byte("new"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if got := readString(t, b.fs, path.Join(dir, "conf")); got != "new" {
+				t.Errorf("conf = %q, want %q", got, "new")
+			}
+			if err := ioutil.WriteFile(view, "/other", []byte("x"), 0644); !errors.Is(err, rofs.ErrReadOnly) {
+				t.Errorf("creating a file: got %v, want ErrReadOnly", err)
+			}
+			if _, err := view.OpenFile("/conf", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644); !errors.Is(err, rofs.ErrReadOnly) {
+				t.Errorf("O_EXCL: got %v, want ErrReadOnly", err)
+			}
+
+			// finding out whether O_CREATE would create the file is not an
+			// operation of its own
+			rec := new(eventRecorder)
+			observed, err := rfs.SubFS(dir, rofs.WithCapabilities(rofs.CapWrite), rofs.WithObserver(rec))
+			if err != nil {
+				t.Fatal(err)
+			}
+			cf, err := observed.OpenFile("/conf", os.O_WRONLY|os.O_CREATE, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cf.Close()
+			var ops []string
+			for _, e := range rec.events {
+				ops = append(ops, e.Op+" "+e.Path)
+			}
+			if want := []string{"open /conf", "close /conf"}; !reflect.DeepEqual(ops, want) {
+				t.Errorf("events: got %q, want %q", ops, want)
+			}
+
+			// a file opened for writing keeps the other bits denied
+			view, err = rfs.SubFS(dir, rofs.WithCapabilities(rofs.CapWrite))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := view.OpenFile("/conf", os.O_WRONLY|os.O_TRUNC, 0); !errors.Is(err, rofs.ErrReadOnly) {
+				t.Errorf("O_TRUNC: got %v, want ErrReadOnly", err)
+			}
+			f, err := view.OpenFile("/conf", os.O_RDWR, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if _, err := f.WriteAt([]byte("N"), 0); err != nil {
+				t.Error(err)
+			}
+			if err := f.Truncate(0); !errors.Is(err, rofs.ErrReadOnly) {
+				t.Errorf("File.Truncate: got %v, want ErrReadOnly", err)
+			}
+
+			// the default stays read-only
+			view, err = rfs.SubFS(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := view.OpenFile("/conf", os.O_WRONLY, 0); !errors.Is(err, rofs.ErrReadOnly) {
+				t.Errorf("default view: got %v, want ErrReadOnly", err)
+			}
+		})
+	}
+}
+
+func TestCapabilityString(t *testing.T) {
+	for c, want := range map[rofs.Capability]string{
+		rofs.CapNone:                    "none",
+		rofs.CapChmod | rofs.CapChtimes: "chmod|chtimes",
+		rofs.CapAll:                     "write|create|mkdir|remove|rename|chmod|chown|chtimes|truncate|symlink",
+	} {
+		if got := c.String(); got != want {
+			t.Errorf("%#x.String() = %q, want %q", uint16(c), got, want)
+		}
+	}
+}
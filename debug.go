@@ -0,0 +1,217 @@
+package rofs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Debug records where refused writes come from, to track down code that
+// writes to a read-only view. Give it to views with WithDebug. The zero value
+// is ready to use.
+type Debug struct {
+	// Strict makes the first refused operation panic with its error, which
+	// fails a test at the offending call.
+	Strict bool
+
+	mu    sync.Mutex
+	sites map[string]*WriteSite
+}
+
+// WithDebug captures the stack of the caller each time the view refuses an
+// operation as read-only, append-only, retained or sealed. The stack is
+// attached to the returned error as a *StackError, and the call site is
+// added to the report of d.
+func WithDebug(d *Debug) Option {
+	return func(o *options) {
+		o.debug = d
+	}
+}
+
+// maxStackDepth bounds the number of frames captured for a refused write.
+const maxStackDepth = 32
+
+// StackError is the error of an operation refused under WithDebug. It is
+// returned wrapped in the *fs.PathError or *os.LinkError of the operation,
+// and can be retrieved with errors.As:
+//
+//	var se *rofs.StackError
+//	if errors.As(err, &se) {
+//		log.Printf("write refused at %s:\n%s", se.Caller().Function, se.Stack())
+//	}
+type StackError struct {
+	// Err is the error the operation was refused with, such as ErrReadOnly.
+	Err error
+
+	// Frames holds the stack of the goroutine that made the operation,
+	// innermost first, without the frames inside rofs.
+	Frames []runtime.Frame
+}
+
+func (e *StackError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StackError) Unwrap() error {
+	return e.Err
+}
+
+// Caller returns the innermost frame outside rofs, the call site of the
+// refused operation.
+func (e *StackError) Caller() runtime.Frame {
+	if len(e.Frames) == 0 {
+		return runtime.Frame{}
+	}
+	return e.Frames[0]
+}
+
+// Stack formats the frames like the stack traces printed by panics.
+func (e *StackError) Stack() string {
+	var b strings.Builder
+	for _, fr := range e.Frames {
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", fr.Function, fr.File, fr.Line)
+	}
+	return b.String()
+}
+
+// WriteSite is a call site reported by Debug.
+type WriteSite struct {
+	// Caller is the call site, the innermost frame outside rofs.
+	Caller runtime.Frame
+
+	// Stack is the formatted stack of the first refusal at the site.
+	Stack string
+
+	// Count is the number of refusals at the site, and Ops and Paths hold
+	// their distinct operations and paths in the order they were first
+	// seen.
+	Count int
+	Ops   []string
+	Paths []string
+}
+
+// pkgPrefix is the prefix of the names of the functions in this package.
+var pkgPrefix = strings.TrimSuffix(runtime.FuncForPC(reflect.ValueOf(nop).Pointer()).Name(), "nop")
+
+// capture attaches the stack of the caller to err, the error of a refused
+// operation, and records its call site.
+func (d *Debug) capture(err error) error {
+	pcs := make([]uintptr, maxStackDepth+16)
+	pcs = pcs[:runtime.Callers(2, pcs)]
+	frames := runtime.CallersFrames(pcs)
+	se := new(StackError)
+	for len(se.Frames) < maxStackDepth {
+		fr, more := frames.Next()
+		if !strings.HasPrefix(fr.Function, pkgPrefix) && fr.Function != "runtime.goexit" {
+			se.Frames = append(se.Frames, fr)
+		}
+		if !more {
+			break
+		}
+	}
+
+	var op, name string
+	var pe *fs.PathError
+	var le *os.LinkError
+	switch {
+	case errors.As(err, &pe):
+		op, name = pe.Op, pe.Path
+		se.Err = pe.Err
+		err = &fs.PathError{Op: pe.Op, Path: pe.Path, Err: se}
+	case errors.As(err, &le):
+		op, name = le.Op, le.Old
+		if le.Op == "symlink" {
+			name = le.New
+		}
+		se.Err = le.Err
+		err = &os.LinkError{Op: le.Op, Old: le.Old, New: le.New, Err: se}
+	default:
+		se.Err = err
+		err = se
+	}
+	d.record(se, op, name)
+	return err
+}
+
+func (d *Debug) record(se *StackError, op, name string) {
+	caller := se.Caller()
+	key := fmt.Sprintf("%s:%d", caller.File, caller.Line)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.sites == nil {
+		d.sites = make(map[string]*WriteSite)
+	}
+	s := d.sites[key]
+	if s == nil {
+		s = &WriteSite{Caller: caller, Stack: se.Stack()}
+		d.sites[key] = s
+	}
+	s.Count++
+	s.Ops = appendNew(s.Ops, op)
+	s.Paths = appendNew(s.Paths, name)
+}
+
+func appendNew(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// Sites returns the call sites of the operations refused so far, the most
+// frequent first.
+func (d *Debug) Sites() []WriteSite {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	sites := make([]WriteSite, 0, len(d.sites))
+	for _, s := range d.sites {
+		c := *s
+		c.Ops = append([]string(nil), s.Ops...)
+		c.Paths = append([]string(nil), s.Paths...)
+		sites = append(sites, c)
+	}
+	sort.Slice(sites, func(i, j int) bool {
+		a, b := sites[i], sites[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Caller.File != b.Caller.File {
+			return a.Caller.File < b.Caller.File
+		}
+		return a.Caller.Line < b.Caller.Line
+	})
+	return sites
+}
+
+// WriteReport writes a report of the call sites returned by Sites to w.
+func (d *Debug) WriteReport(w io.Writer) error {
+	sites := d.Sites()
+	if len(sites) == 0 {
+		_, err := fmt.Fprintln(w, "no refused writes")
+		return err
+	}
+	for _, s := range sites {
+		_, err := fmt.Fprintf(w, "%d refused at %s:%d (%s) on %s\n%s\n",
+			s.Count, s.Caller.File, s.Caller.Line, strings.Join(s.Ops, ", "), strings.Join(s.Paths, ", "), s.Stack)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reset forgets the call sites recorded so far.
+func (d *Debug) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sites = nil
+}
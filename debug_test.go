@@ -0,0 +1,109 @@
+package rofs_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/memfs"
+	"github.com/absfs/rofs"
+)
+
+func saveSettings(fsys absfs.FileSystem) error {
+	f, err := fsys.OpenFile("/settings", os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func cleanCache(fsys absfs.FileSystem) error {
+	return fsys.RemoveAll("/cache")
+}
+
+func TestDebugStacks(t *testing.T) {
+	mfs, err := memfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustMkdirAll(t, mfs, "/cache")
+	d := new(rofs.Debug)
+	rfs, err := rofs.NewFS(mfs, rofs.WithDebug(d))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = saveSettings(rfs)
+	var pe *fs.PathError
+	if !errors.As(err, &pe) || !errors.Is(err, rofs.ErrReadOnly) || err.Error() != "open /settings: read-only file system" {
+		t.Fatalf("saveSettings: got %v, want a *PathError matching ErrReadOnly", err)
+	}
+	var se *rofs.StackError
+	if !errors.As(err, &se) {
+		t.Fatalf("no *StackError in %v", err)
+	}
+	if fn := se.Caller().Function; !strings.HasSuffix(fn, ".saveSettings") {
+		t.Errorf("Caller() = %s, want saveSettings", fn)
+	}
+	if stack := se.Stack(); !strings.Contains(stack, "TestDebugStacks") || strings.Contains(stack, "rofs.(*FileSystem)") {
+		t.Errorf("stack not trimmed to the callers:\n%s", stack)
+	}
+
+	saveSettings(rfs)
+	cleanCache(rfs)
+	if f, err := rfs.Open("/cache"); err != nil {
+		t.Fatal(err)
+	} else {
+		// reads are not reported
+		f.Close()
+	}
+
+	sites := d.Sites()
+	if len(sites) != 2 {
+		t.Fatalf("%d sites, want 2: %+v", len(sites), sites)
+	}
+	if s := sites[0]; !strings.HasSuffix(s.Caller.Function, ".saveSettings") || s.Count != 2 || s.Ops[0] != "open" || s.Paths[0] != "/settings" {
+		t.Errorf("first site: %+v", s)
+	}
+	if s := sites[1]; !strings.HasSuffix(s.Caller.Function, ".cleanCache") || s.Count != 1 || s.Ops[0] != "removeall" {
+		t.Errorf("second site: %+v", s)
+	}
+
+	var report strings.Builder
+	if err := d.WriteReport(&report); err != nil {
+		t.Fatal(err)
+	}
+	if out := report.String(); !strings.Contains(out, "2 refused at ") || !strings.Contains(out, "(removeall) on /cache") {
+		t.Errorf("report:\n%s", out)
+	}
+	d.Reset()
+	if len(d.Sites()) != 0 {
+		t.Error("Sites not empty after Reset")
+	}
+}
+
+func TestDebugStrict(t *testing.T) {
+	mfs, err := memfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rfs, err := rofs.NewFS(mfs, rofs.WithDebug(&rofs.Debug{Strict: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rfs.Stat("/"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err, _ := recover().(error)
+		var se *rofs.StackError
+		if !errors.As(err, &se) || !strings.HasSuffix(se.Caller().Function, ".saveSettings") {
+			t.Errorf("recovered %v, want the *StackError of saveSettings", err)
+		}
+	}()
+	saveSettings(rfs)
+	t.Error("denied write did not panic")
+}
@@ -0,0 +1,168 @@
+package rofs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change in a
+// unified diff.
+const diffContext = 3
+
+// edit is one line of a line-based diff: unchanged (' '), removed ('-') or
+// added ('+').
+type edit struct {
+	op   byte
+	line string
+}
+
+// writeUnified writes a unified diff between a and b, labelled from and to.
+func writeUnified(w io.Writer, from, to string, a, b []byte) error {
+	if bytes.IndexByte(a, 0) >= 0 || bytes.IndexByte(b, 0) >= 0 {
+		_, err := fmt.Fprintf(w, "Binary files %s and %s differ\n", from, to)
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "--- %s\n+++ %s\n", from, to); err != nil {
+		return err
+	}
+
+	edits := diffLines(splitLines(a), splitLines(b))
+	// lines[i] holds the number of lines of a and b before edits[i]
+	lines := make([][2]int, len(edits)+1)
+	for i, e := range edits {
+		lines[i+1] = lines[i]
+		if e.op != '+' {
+			lines[i+1][0]++
+		}
+		if e.op != '-' {
+			lines[i+1][1]++
+		}
+	}
+
+	for i := 0; i < len(edits); {
+		if edits[i].op == ' ' {
+			i++
+			continue
+		}
+		start := max(i-diffContext, 0)
+		last := i
+		for j := i; j < len(edits) && j-last <= 2*diffContext; j++ {
+			if edits[j].op != ' ' {
+				last = j
+			}
+		}
+		end := min(last+diffContext+1, len(edits))
+
+		if _, err := fmt.Fprintf(w, "@@ -%s +%s @@\n",
+			hunkRange(lines[start][0], lines[end][0]-lines[start][0]),
+			hunkRange(lines[start][1], lines[end][1]-lines[start][1])); err != nil {
+			return err
+		}
+		for _, e := range edits[start:end] {
+			line := e.line
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n\\ No newline at end of file\n"
+			}
+			if _, err := fmt.Fprintf(w, "%c%s", e.op, line); err != nil {
+				return err
+			}
+		}
+		i = end
+	}
+	return nil
+}
+
+// hunkRange formats the range of a hunk that starts after line start and
+// spans n lines.
+func hunkRange(start, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if n == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
+
+// splitLines splits data into lines, keeping the line terminators.
+func splitLines(data []byte) []string {
+	var lines []string
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n') + 1
+		if i == 0 {
+			i = len(data)
+		}
+		lines = append(lines, string(data[:i]))
+		data = data[i:]
+	}
+	return lines
+}
+
+// diffLines returns a shortest edit script from a to b, computed with the
+// algorithm of Myers' "An O(ND) Difference Algorithm and Its Variations".
+func diffLines(a, b []string) []edit {
+	n, m := len(a), len(b)
+	offset := n + m
+	v := make([]int, 2*offset+2)
+	var trace [][]int
+
+search:
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	var edits []edit
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prev int
+		if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+			prev = k + 1
+		} else {
+			prev = k - 1
+		}
+		px := v[offset+prev]
+		py := px - prev
+		for x > px && y > py {
+			x--
+			y--
+			edits = append(edits, edit{' ', a[x]})
+		}
+		if x == px {
+			y--
+			edits = append(edits, edit{'+', b[y]})
+		} else {
+			x--
+			edits = append(edits, edit{'-', a[x]})
+		}
+	}
+	for x > 0 {
+		x--
+		edits = append(edits, edit{' ', a[x]})
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
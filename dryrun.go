@@ -0,0 +1,211 @@
+package rofs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/absfs/absfs"
+)
+
+// DryRun is a FileSystem on which every mutating operation succeeds without
+// touching the wrapped filesystem. Changes are kept in memory, so reads
+// reflect them and programs behave as they would on the real filesystem, and
+// each change is recorded in an ordered plan that can be printed, encoded as
+// JSON or rendered as a unified diff against the wrapped filesystem.
+//
+// Changes are kept in a new memfs unless an upper layer is given with
+// WithScratch. Options restricting writes, such as WithAppendOnly, still
+// apply; paths outside WithWritable subtrees are writable in a dry run.
+type DryRun struct {
+	*FileSystem
+	ov   *overlay
+	plan []Action // guarded by ov.mu
+}
+
+// An Action is a change recorded by a DryRun. Paths are those of the wrapped
+// filesystem.
+type Action struct {
+	// Op is the operation: "create", "write", "truncate", "mkdir", "remove",
+	// "removeall", "rename", "symlink", "chmod", "chown", "lchown" or
+	// "chtimes".
+	Op   string `json:"op"`
+	Path string `json:"path"`
+
+	// Target is the new path of a rename and the target of a symlink.
+	Target string `json:"target,omitempty"`
+
+	// Mode is the mode of a create, mkdir or chmod.
+	Mode fs.FileMode `json:"mode,omitempty"`
+
+	// Offset and Size are the position and length of a write; Size is also
+	// the new size of a truncate.
+	Offset int64 `json:"offset,omitempty"`
+	Size   int64 `json:"size,omitempty"`
+
+	UID   *int       `json:"uid,omitempty"`
+	GID   *int       `json:"gid,omitempty"`
+	Atime *time.Time `json:"atime,omitempty"`
+	Mtime *time.Time `json:"mtime,omitempty"`
+}
+
+// String returns a one-line description of the action.
+func (a Action) String() string {
+	switch a.Op {
+	case "create", "mkdir", "chmod":
+		return fmt.Sprintf("%s %s %#o", a.Op, a.Path, a.Mode)
+	case "write":
+		return fmt.Sprintf("write %s %d bytes at %d", a.Path, a.Size, a.Offset)
+	case "truncate":
+		return fmt.Sprintf("truncate %s %d", a.Path, a.Size)
+	case "rename", "symlink":
+		return fmt.Sprintf("%s %s -> %s", a.Op, a.Path, a.Target)
+	case "chown", "lchown":
+		return fmt.Sprintf("%s %s %d:%d", a.Op, a.Path, *a.UID, *a.GID)
+	case "chtimes":
+		return fmt.Sprintf("chtimes %s %s %s", a.Path, a.Atime.Format(time.RFC3339), a.Mtime.Format(time.RFC3339))
+	}
+	return a.Op + " " + a.Path
+}
+
+// NewDryRun returns a DryRun over fs.
+func NewDryRun(fs absfs.SymlinkFileSystem, opts ...Option) (*DryRun, error) {
+	f, err := newFS(fs, opts)
+	if err != nil {
+		return nil, err
+	}
+	ov, err := newOverlay(fs, f.opts.scratch)
+	if err != nil {
+		return nil, err
+	}
+	f.fs, f.ov = ov, ov
+	d := &DryRun{FileSystem: f, ov: ov}
+	ov.log = func(a Action, _ []byte) error {
+		d.plan = append(d.plan, a)
+		return nil
+	}
+	return d, nil
+}
+
+// Plan returns the changes made so far, in order.
+func (d *DryRun) Plan() []Action {
+	d.ov.mu.RLock()
+	defer d.ov.mu.RUnlock()
+	return append([]Action(nil), d.plan...)
+}
+
+// Discard drops every change and empties the plan.
+func (d *DryRun) Discard() error {
+	if err := d.ov.reset(); err != nil {
+		return err
+	}
+	d.ov.mu.Lock()
+	d.plan = nil
+	d.ov.mu.Unlock()
+	return nil
+}
+
+// WritePlan writes the plan to w, one action per line.
+func (d *DryRun) WritePlan(w io.Writer) error {
+	for _, a := range d.Plan() {
+		if _, err := fmt.Fprintln(w, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the plan to w as a JSON array of actions.
+func (d *DryRun) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	plan := d.Plan()
+	if plan == nil {
+		plan = []Action{}
+	}
+	return enc.Encode(plan)
+}
+
+// WriteDiff writes a unified diff from the wrapped filesystem to the state
+// the dry run has led to. It covers the content of regular files that were
+// created, modified or removed; the plan also lists changes to directories,
+// links, modes and ownership.
+func (d *DryRun) WriteDiff(w io.Writer) error {
+	d.ov.mu.RLock()
+	defer d.ov.mu.RUnlock()
+	o := d.ov
+
+	paths := make(map[string]bool)
+	walkFiles(o.upper, "/", paths)
+	for _, m := range []map[string]bool{o.deleted, o.opaque} {
+		for p := range m {
+			walkFiles(o.lower, p, paths)
+		}
+	}
+	names := make([]string, 0, len(paths))
+	for p := range paths {
+		names = append(names, p)
+	}
+	sort.Strings(names)
+
+	for _, p := range names {
+		before, hadBefore := regularContent(o.lower, p)
+		var after []byte
+		hasAfter := false
+		if info, layer, err := o.find(p); err == nil && info.Mode().IsRegular() {
+			after, hasAfter = regularContent(layer, p)
+		}
+		if hadBefore == hasAfter && bytes.Equal(before, after) {
+			continue
+		}
+		from, to := "a"+p, "b"+p
+		if !hadBefore {
+			from = "/dev/null"
+		}
+		if !hasAfter {
+			to = "/dev/null"
+		}
+		if err := writeUnified(w, from, to, before, after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkFiles adds the regular files at and below p on fs to files.
+func walkFiles(fs absfs.SymlinkFileSystem, p string, files map[string]bool) {
+	info, err := fs.Lstat(p)
+	if err != nil {
+		return
+	}
+	if info.Mode().IsRegular() {
+		files[p] = true
+		return
+	}
+	if !info.IsDir() {
+		return
+	}
+	entries, err := fs.ReadDir(p)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		walkFiles(fs, path.Join(p, e.Name()), files)
+	}
+}
+
+// regularContent returns the content of the regular file at p on fs, and
+// whether there is one.
+func regularContent(fs absfs.SymlinkFileSystem, p string) ([]byte, bool) {
+	info, err := fs.Lstat(p)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil, false
+	}
+	data, err := fs.ReadFile(p)
+	return data, err == nil
+}
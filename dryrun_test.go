@@ -0,0 +1,276 @@
+package rofs_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/ioutil"
+	"github.com/absfs/rofs"
+)
+
+// tree returns the content of every file, directory and link below dir,
+// keyed by path relative to dir.
+func tree(t *testing.T, fsys absfs.SymlinkFileSystem, dir string) map[string]string {
+	t.Helper()
+	out := make(map[string]string)
+	var walk func(rel string)
+	walk = func(rel string) {
+		entries, err := fsys.ReadDir(path.Join(dir, rel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			name := path.Join(rel, e.Name())
+			full := path.Join(dir, name)
+			info, err := fsys.Lstat(full)
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case info.Mode()&fs.ModeSymlink != 0:
+				target, err := fsys.Readlink(full)
+				if err != nil {
+					t.Fatal(err)
+				}
+				out[name] = "-> " + target
+			case info.IsDir():
+				out[name] = "<dir>"
+				walk(name)
+			default:
+				data, err := fsys.ReadFile(full)
+				if err != nil {
+					t.Fatal(err)
+				}
+				out[name] = string(data)
+			}
+		}
+	}
+	walk("")
+	return out
+}
+
+func TestDryRun(t *testing.T) {
+	for _, b := range testBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			dir := path.Join(b.dir, "dryrun")
+			mustMkdirAll(t, b.fs, path.Join(dir, "etc"))
+			mustMkdirAll(t, b.fs, path.Join(dir, "var", "cache"))
+			mustWrite(t, b.fs, path.Join(dir, "etc", "app.conf"), "port = 80\nhost = a\nmode = x\n")
+			mustWrite(t, b.fs, path.Join(dir, "var", "cache", "blob"), "cached")
+			mustWrite(t, b.fs, path.Join(dir, "old.txt"), "old\n")
+			if err := b.fs.Symlink("etc/app.conf", path.Join(dir, "conf")); err != nil {
+				t.Fatal(err)
+			}
+			before := tree(t, b.fs, dir)
+
+			d, err := rofs.NewDryRun(b.fs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			view, err := d.SubFS(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// a migration run against the view
+			steps := []struct {
+				name string
+				fn   func() error
+			}{
+				{"edit through link", func() error {
+					f, err := view.OpenFile("/conf", os.O_RDWR|os.O_TRUNC, 0)
+					if err != nil {
+						return err
+					}
+					defer f.Close()
+					_, err = f.WriteString("port = 8080\nhost = a\nmode = x\n")
+					return err
+				}},
+				{"mkdir", func() error { return view.MkdirAll("/srv/www", 0755) }},
+				{"create", func() error { return ioutil.WriteFile(view, "/srv/www/index.html", []byte("hello\n"), 0644) }},
+				{"rename", func() error { return view.Rename("/old.txt", "/srv/old.txt") }},
+				{"removeall", func() error { return view.RemoveAll("/var") }},
+				{"chmod", func() error { return view.Chmod("/srv/www/index.html", 0600) }},
+				{"recreate", func() error { return view.Mkdir("/var", 0700) }},
+			}
+			for _, s := range steps {
+				if err := s.fn(); err != nil {
+					t.Fatalf("%s: %v", s.name, err)
+				}
+			}
+
+			t.Run("backend untouched", func(t *testing.T) {
+				if after := tree(t, b.fs, dir); !reflect.DeepEqual(before, after) {
+					t.Errorf("backend changed:\nbefore %v\nafter  %v", before, after)
+				}
+			})
+
+			t.Run("reads reflect changes", func(t *testing.T) {
+				got := tree(t, view, "/")
+				want := map[string]string{
+					"conf":               "-> etc/app.conf",
+					"etc":                "<dir>",
+					"etc/app.conf":       "port = 8080\nhost = a\nmode = x\n",
+					"srv":                "<dir>",
+					"srv/old.txt":        "old\n",
+					"srv/www":            "<dir>",
+					"srv/www/index.html": "hello\n",
+					"var":                "<dir>",
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("view:\ngot  %v\nwant %v", got, want)
+				}
+				if info, err := view.Stat("/srv/www/index.html"); err != nil || info.Mode().Perm() != 0600 {
+					t.Errorf("Stat: got %v, %v", info, err)
+				}
+				if _, err := view.Stat("/old.txt"); !os.IsNotExist(err) {
+					t.Errorf("Stat renamed file: got %v", err)
+				}
+
+				// paged reads of a merged directory
+				f, err := view.Open("/")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.Close()
+				var names []string
+				for {
+					list, err := f.Readdirnames(2)
+					names = append(names, list...)
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+				if want := []string{"conf", "etc", "srv", "var"}; !reflect.DeepEqual(names, want) {
+					t.Errorf("Readdirnames: got %v, want %v", names, want)
+				}
+			})
+
+			t.Run("plan", func(t *testing.T) {
+				var ops []string
+				for _, a := range d.Plan() {
+					ops = append(ops, a.Op+" "+strings.TrimPrefix(a.Path, dir))
+				}
+				want := []string{
+					"truncate /etc/app.conf",
+					"write /etc/app.conf",
+					"mkdir /srv",
+					"mkdir /srv/www",
+					"create /srv/www/index.html",
+					"write /srv/www/index.html",
+					"rename /old.txt",
+					"removeall /var",
+					"chmod /srv/www/index.html",
+					"mkdir /var",
+				}
+				if !reflect.DeepEqual(ops, want) {
+					t.Errorf("plan:\ngot  %q\nwant %q", ops, want)
+				}
+
+				var text bytes.Buffer
+				if err := d.WritePlan(&text); err != nil {
+					t.Fatal(err)
+				}
+				if lines := strings.Split(strings.TrimSpace(text.String()), "\n"); len(lines) != len(want) ||
+					lines[1] != "write "+path.Join(dir, "etc/app.conf")+" 30 bytes at 0" {
+					t.Errorf("WritePlan:\n%s", text.String())
+				}
+
+				var js bytes.Buffer
+				if err := d.WriteJSON(&js); err != nil {
+					t.Fatal(err)
+				}
+				var decoded []rofs.Action
+				if err := json.Unmarshal(js.Bytes(), &decoded); err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(decoded, d.Plan()) {
+					t.Errorf("JSON round trip:\n%s", js.String())
+				}
+			})
+
+			t.Run("diff", func(t *testing.T) {
+				var out bytes.Buffer
+				if err := d.WriteDiff(&out); err != nil {
+					t.Fatal(err)
+				}
+				want := strings.Join([]string{
+					"--- a" + dir + "/etc/app.conf",
+					"+++ b" + dir + "/etc/app.conf",
+					"@@ -1,3 +1,3 @@",
+					"-port = 80",
+					"+port = 8080",
+					" host = a",
+					" mode = x",
+					"--- a" + dir + "/old.txt",
+					"+++ /dev/null",
+					"@@ -1 +0,0 @@",
+					"-old",
+					"--- /dev/null",
+					"+++ b" + dir + "/srv/old.txt",
+					"@@ -0,0 +1 @@",
+					"+old",
+					"--- /dev/null",
+					"+++ b" + dir + "/srv/www/index.html",
+					"@@ -0,0 +1 @@",
+					"+hello",
+					"--- a" + dir + "/var/cache/blob",
+					"+++ /dev/null",
+					"@@ -1 +0,0 @@",
+					"-cached",
+					"\\ No newline at end of file",
+				}, "\n") + "\n"
+				if out.String() != want {
+					t.Errorf("diff:\n%s\nwant:\n%s", out.String(), want)
+				}
+			})
+		})
+	}
+}
+
+func TestDryRunDiffHunks(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 20; i++ {
+		lines = append(lines, strings.Repeat("x", i))
+	}
+	orig := strings.Join(lines, "\n") + "\n"
+	lines[1] = "changed 2"
+	lines[17] = "changed 18"
+	changed := strings.Join(lines, "\n") + "\n"
+
+	b := testBackends(t)[0]
+	mustWrite(t, b.fs, path.Join(b.dir, "f"), orig)
+	d, err := rofs.NewDryRun(b.fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(d, path.Join(b.dir, "f"), []byte(changed), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := d.WriteDiff(&out); err != nil {
+		t.Fatal(err)
+	}
+	var headers []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.HasPrefix(line, "@@") {
+			headers = append(headers, line)
+		}
+	}
+	sort.Strings(headers)
+	if want := []string{"@@ -1,5 +1,5 @@", "@@ -15,6 +15,6 @@"}; !reflect.DeepEqual(headers, want) {
+		t.Errorf("hunks: got %q, want %q\n%s", headers, want, out.String())
+	}
+}
@@ -0,0 +1,115 @@
+package rofs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// ErrReadOnly is the error rofs reports for every operation it refuses
+// because the filesystem is read-only. It is always returned wrapped in a
+// *fs.PathError or *os.LinkError naming the operation and path.
+//
+// errors.Is reports true when ErrReadOnly is compared with itself,
+// fs.ErrPermission or syscall.EROFS, so callers can distinguish a read-only
+// mount from a permission error raised by the underlying filesystem. Note that
+// the legacy os.IsPermission does not unwrap custom errors; use errors.Is
+// instead.
+var ErrReadOnly error = readOnlyError{}
+
+type readOnlyError struct{}
+
+func (readOnlyError) Error() string {
+	return "read-only file system"
+}
+
+func (readOnlyError) Is(target error) bool {
+	return target == fs.ErrPermission || target == syscall.EROFS
+}
+
+// ErrAppendOnly is the error rofs reports for operations it refuses because
+// they would modify existing data in an append-only subtree. It is always
+// returned wrapped in a *fs.PathError or *os.LinkError.
+//
+// errors.Is reports true when ErrAppendOnly is compared with itself,
+// ErrReadOnly, fs.ErrPermission or syscall.EPERM, the error Linux reports for
+// files with the append-only attribute.
+var ErrAppendOnly error = appendOnlyError{}
+
+type appendOnlyError struct{}
+
+func (appendOnlyError) Error() string {
+	return "append-only file"
+}
+
+func (appendOnlyError) Is(target error) bool {
+	return target == ErrReadOnly || target == fs.ErrPermission || target == syscall.EPERM
+}
+
+// refused passes err, the error of an operation the view may have refused,
+// through the debugging and auditing set up for the view before it is
+// returned. Errors that are not refusals are returned as they are.
+func (f *FileSystem) refused(err error) error {
+	return f.refusedFlags(err, -1)
+}
+
+// refusedFlags is refused for OpenFile, which also reports flag.
+func (f *FileSystem) refusedFlags(err error, flag int) error {
+	if err == nil || f.opts.audit == nil && f.opts.debug == nil || !errors.Is(err, ErrReadOnly) {
+		return err
+	}
+	if f.opts.debug != nil {
+		err = f.opts.debug.capture(err)
+	}
+	if f.opts.audit != nil {
+		f.audit(err, flag)
+	}
+	if f.opts.debug != nil && f.opts.debug.Strict {
+		panic(err)
+	}
+	return err
+}
+
+// readOnly returns ErrReadOnly wrapped in a *fs.PathError.
+func readOnly(op, name string) error {
+	return &fs.PathError{Op: op, Path: name, Err: ErrReadOnly}
+}
+
+// readOnlyLink returns ErrReadOnly wrapped in a *os.LinkError.
+func readOnlyLink(op, oldname, newname string) error {
+	return &os.LinkError{Op: op, Old: oldname, New: newname, Err: ErrReadOnly}
+}
+
+// appendOnly returns ErrAppendOnly wrapped in a *fs.PathError.
+func appendOnly(op, name string) error {
+	return &fs.PathError{Op: op, Path: name, Err: ErrAppendOnly}
+}
+
+// underlying returns the error wrapped by a *fs.PathError or *os.LinkError,
+// or err itself.
+func underlying(err error) error {
+	switch e := err.(type) {
+	case *fs.PathError:
+		return e.Err
+	case *os.LinkError:
+		return e.Err
+	}
+	return err
+}
+
+// ErrNotSupported is returned, wrapped in a *fs.PathError or *os.LinkError,
+// for operations the wrapped backend has no way to perform, such as Readlink
+// on a backend without symbolic links. errors.Is reports true when it is
+// compared with itself, errors.ErrUnsupported or syscall.ENOTSUP.
+var ErrNotSupported error = notSupportedError{}
+
+type notSupportedError struct{}
+
+func (notSupportedError) Error() string {
+	return "operation not supported"
+}
+
+func (notSupportedError) Is(target error) bool {
+	return target == errors.ErrUnsupported || target == syscall.ENOTSUP
+}
@@ -0,0 +1,137 @@
+package rofs_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/absfs/rofs"
+)
+
+func TestErrReadOnly(t *testing.T) {
+	t.Run("matches itself, ErrPermission and EROFS", func(t *testing.T) {
+		for _, target := range []error{rofs.ErrReadOnly, fs.ErrPermission, syscall.EROFS} {
+			if !errors.Is(rofs.ErrReadOnly, target) {
+				t.Errorf("errors.Is(ErrReadOnly, %v): expected true", target)
+			}
+		}
+	})
+
+	t.Run("does not match unrelated errors", func(t *testing.T) {
+		for _, target := range []error{fs.ErrNotExist, fs.ErrExist, syscall.EACCES, syscall.EPERM} {
+			if errors.Is(rofs.ErrReadOnly, target) {
+				t.Errorf("errors.Is(ErrReadOnly, %v): expected false", target)
+			}
+		}
+	})
+
+	t.Run("backend permission errors are not ErrReadOnly", func(t *testing.T) {
+		err := &fs.PathError{Op: "open", Path: "/x", Err: fs.ErrPermission}
+		if errors.Is(err, rofs.ErrReadOnly) {
+			t.Error("plain permission error should not match ErrReadOnly")
+		}
+	})
+}
+
+func TestDeniedOperationsReturnErrReadOnly(t *testing.T) {
+	rfs, _ := setupTestFS(t)
+
+	file, err := rfs.Open("/testdir/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	pathOps := []struct {
+		op   string
+		path string
+		fn   func() error
+	}{
+		{"open", "/testdir/file.txt", func() error {
+			_, err := rfs.OpenFile("/testdir/file.txt", os.O_RDWR, 0)
+			return err
+		}},
+		{"open", "/new.txt", func() error {
+			_, err := rfs.Create("/new.txt")
+			return err
+		}},
+		{"mkdir", "/newdir", func() error { return rfs.Mkdir("/newdir", 0755) }},
+		{"mkdir", "/a/b/c", func() error { return rfs.MkdirAll("/a/b/c", 0755) }},
+		{"remove", "/testdir/file.txt", func() error { return rfs.Remove("/testdir/file.txt") }},
+		{"removeall", "/testdir", func() error { return rfs.RemoveAll("/testdir") }},
+		{"chmod", "/testdir/file.txt", func() error { return rfs.Chmod("/testdir/file.txt", 0600) }},
+		{"chtimes", "/testdir/file.txt", func() error {
+			return rfs.Chtimes("/testdir/file.txt", time.Now(), time.Now())
+		}},
+		{"chown", "/testdir/file.txt", func() error { return rfs.Chown("/testdir/file.txt", 1, 1) }},
+		{"lchown", "/testdir/link.txt", func() error { return rfs.Lchown("/testdir/link.txt", 1, 1) }},
+		{"truncate", "/testdir/file.txt", func() error { return rfs.Truncate("/testdir/file.txt", 0) }},
+		{"write", "/testdir/file.txt", func() error {
+			_, err := file.Write([]byte("x"))
+			return err
+		}},
+		{"write", "/testdir/file.txt", func() error {
+			_, err := file.WriteAt([]byte("x"), 0)
+			return err
+		}},
+		{"write", "/testdir/file.txt", func() error {
+			_, err := file.WriteString("x")
+			return err
+		}},
+		{"truncate", "/testdir/file.txt", func() error { return file.Truncate(0) }},
+	}
+
+	for _, tt := range pathOps {
+		t.Run(tt.op+" "+tt.path, func(t *testing.T) {
+			err := tt.fn()
+			var pathErr *fs.PathError
+			if !errors.As(err, &pathErr) {
+				t.Fatalf("expected *fs.PathError, got %T %v", err, err)
+			}
+			if pathErr.Op != tt.op {
+				t.Errorf("PathError.Op: expected %q, got %q", tt.op, pathErr.Op)
+			}
+			if pathErr.Path != tt.path {
+				t.Errorf("PathError.Path: expected %q, got %q", tt.path, pathErr.Path)
+			}
+			if pathErr.Err != rofs.ErrReadOnly {
+				t.Errorf("PathError.Err: expected ErrReadOnly, got %v", pathErr.Err)
+			}
+			if !errors.Is(err, syscall.EROFS) {
+				t.Errorf("expected errors.Is(err, syscall.EROFS)")
+			}
+		})
+	}
+
+	linkOps := []struct {
+		op       string
+		old, new string
+		fn       func() error
+	}{
+		{"rename", "/testdir/file.txt", "/moved.txt", func() error {
+			return rfs.Rename("/testdir/file.txt", "/moved.txt")
+		}},
+		{"symlink", "/testdir/file.txt", "/sym.txt", func() error {
+			return rfs.Symlink("/testdir/file.txt", "/sym.txt")
+		}},
+	}
+
+	for _, tt := range linkOps {
+		t.Run(tt.op, func(t *testing.T) {
+			err := tt.fn()
+			var linkErr *os.LinkError
+			if !errors.As(err, &linkErr) {
+				t.Fatalf("expected *os.LinkError, got %T %v", err, err)
+			}
+			if linkErr.Op != tt.op || linkErr.Old != tt.old || linkErr.New != tt.new {
+				t.Errorf("LinkError: got %q %q %q", linkErr.Op, linkErr.Old, linkErr.New)
+			}
+			if !errors.Is(err, rofs.ErrReadOnly) {
+				t.Errorf("expected errors.Is(err, ErrReadOnly), got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package rofs
+
+import (
+	"io/fs"
+)
+
+// writeBits are the permission bits cleared by WithMaskedWriteBits.
+const writeBits fs.FileMode = 0222
+
+// maskedInfo reports the mode of a FileInfo with its write bits cleared. Sys
+// and every other method pass through to the wrapped FileInfo.
+type maskedInfo struct {
+	fs.FileInfo
+}
+
+func (m maskedInfo) Mode() fs.FileMode {
+	return m.FileInfo.Mode() &^ writeBits
+}
+
+// maskedEntry is a DirEntry whose Info is masked the first time, and only
+// when, it is requested.
+type maskedEntry struct {
+	fs.DirEntry
+}
+
+func (m maskedEntry) Info() (fs.FileInfo, error) {
+	info, err := m.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	return maskedInfo{info}, nil
+}
+
+func (m maskedEntry) String() string {
+	return fs.FormatDirEntry(m)
+}
+
+// info applies the view's FileInfo options to info.
+func (f *FileSystem) info(info fs.FileInfo) fs.FileInfo {
+	if info == nil || !f.opts.maskWrite {
+		return info
+	}
+	return maskedInfo{info}
+}
+
+// infos applies the view's FileInfo options to every element of infos.
+func (f *FileSystem) infos(infos []fs.FileInfo) []fs.FileInfo {
+	if !f.opts.maskWrite {
+		return infos
+	}
+	for i, info := range infos {
+		infos[i] = maskedInfo{info}
+	}
+	return infos
+}
+
+// entries applies the view's FileInfo options to every element of entries.
+func (f *FileSystem) entries(entries []fs.DirEntry) []fs.DirEntry {
+	if !f.opts.maskWrite {
+		return entries
+	}
+	for i, e := range entries {
+		entries[i] = maskedEntry{e}
+	}
+	return entries
+}
@@ -0,0 +1,218 @@
+package rofs_test
+
+import (
+	"io/fs"
+	"path"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/absfs/rofs"
+)
+
+func TestMaskedWriteBits(t *testing.T) {
+	for _, b := range testBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			dir := path.Join(b.dir, "masked")
+			mustMkdirAll(t, b.fs, path.Join(dir, "sub"))
+			mustWrite(t, b.fs, path.Join(dir, "file.txt"), "content")
+			if err := b.fs.Chmod(path.Join(dir, "file.txt"), 0664); err != nil {
+				t.Fatal(err)
+			}
+			if err := b.fs.Symlink("file.txt", path.Join(dir, "link")); err != nil {
+				t.Fatal(err)
+			}
+
+			rfs, err := rofs.NewFS(b.fs, rofs.WithMaskedWriteBits())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			check := func(t *testing.T, what string, info fs.FileInfo) {
+				t.Helper()
+				if info.Mode().Perm()&0222 != 0 {
+					t.Errorf("%s %s: write bits set in %s", what, info.Name(), info.Mode())
+				}
+			}
+
+			t.Run("Stat", func(t *testing.T) {
+				info, err := rfs.Stat(path.Join(dir, "file.txt"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				check(t, "Stat", info)
+				if info.Mode().Perm() != 0444 {
+					t.Errorf("Stat: expected 0444, got %o", info.Mode().Perm())
+				}
+				if info.Size() != int64(len("content")) || info.Name() != "file.txt" {
+					t.Errorf("Stat: other fields changed: %s %d", info.Name(), info.Size())
+				}
+
+				info, err = rfs.Stat(path.Join(dir, "sub"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				check(t, "Stat", info)
+				if !info.IsDir() {
+					t.Error("Stat: directory bit lost")
+				}
+			})
+
+			t.Run("Lstat", func(t *testing.T) {
+				info, err := rfs.Lstat(path.Join(dir, "link"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				check(t, "Lstat", info)
+				if info.Mode()&fs.ModeSymlink == 0 {
+					t.Error("Lstat: symlink bit lost")
+				}
+			})
+
+			t.Run("File.Stat and Readdir", func(t *testing.T) {
+				d, err := rfs.Open(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer d.Close()
+				info, err := d.Stat()
+				if err != nil {
+					t.Fatal(err)
+				}
+				check(t, "File.Stat", info)
+
+				infos, err := d.Readdir(-1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(infos) != 3 {
+					t.Errorf("Readdir: expected 3 entries, got %d", len(infos))
+				}
+				for _, info := range infos {
+					check(t, "Readdir", info)
+				}
+			})
+
+			t.Run("ReadDir", func(t *testing.T) {
+				entries, err := rfs.ReadDir(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				d, err := rfs.Open(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer d.Close()
+				more, err := d.ReadDir(-1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, e := range append(entries, more...) {
+					info, err := e.Info()
+					if err != nil {
+						t.Fatal(err)
+					}
+					check(t, "ReadDir", info)
+					if e.Type() != info.Mode().Type() {
+						t.Errorf("ReadDir %s: Type %s does not match Info %s", e.Name(), e.Type(), info.Mode())
+					}
+				}
+			})
+
+			t.Run("Sys is reachable", func(t *testing.T) {
+				info, err := rfs.Stat(path.Join(dir, "file.txt"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				raw, err := b.fs.Stat(path.Join(dir, "file.txt"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if reflect.TypeOf(info.Sys()) != reflect.TypeOf(raw.Sys()) {
+					t.Errorf("Sys: got %T, backend %T", info.Sys(), raw.Sys())
+				}
+			})
+
+			t.Run("io/fs", func(t *testing.T) {
+				sub, err := rfs.Sub(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := fstest.TestFS(sub, "file.txt", "sub"); err != nil {
+					t.Fatal(err)
+				}
+			})
+
+			t.Run("unmasked by default", func(t *testing.T) {
+				plain, err := rofs.NewFS(b.fs)
+				if err != nil {
+					t.Fatal(err)
+				}
+				info, err := plain.Stat(path.Join(dir, "file.txt"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Mode().Perm() != 0664 {
+					t.Errorf("Stat: expected 0664, got %o", info.Mode().Perm())
+				}
+			})
+		})
+	}
+}
+
+// countingFS counts calls to DirEntry.Info on the entries it returns.
+type countingFS struct {
+	fstest.MapFS
+	calls *int
+}
+
+type countingEntry struct {
+	fs.DirEntry
+	calls *int
+}
+
+func (c countingEntry) Info() (fs.FileInfo, error) {
+	*c.calls++
+	return c.DirEntry.Info()
+}
+
+func (c countingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := c.MapFS.ReadDir(name)
+	for i, e := range entries {
+		entries[i] = countingEntry{e, c.calls}
+	}
+	return entries, err
+}
+
+func TestMaskedDirEntryInfoIsLazy(t *testing.T) {
+	calls := 0
+	rfs, err := rofs.NewFromIOFS(countingFS{fstest.MapFS{
+		"a.txt": {Data: []byte("a"), Mode: 0666},
+		"b.txt": {Data: []byte("b"), Mode: 0644},
+	}, &calls}, rofs.WithMaskedWriteBits())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := rfs.ReadDir("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("ReadDir: expected 2 entries, got %d", len(entries))
+	}
+	if calls != 0 {
+		t.Errorf("ReadDir called Info %d times", calls)
+	}
+
+	info, err := entries[0].Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Errorf("Info: expected 1 call, got %d", calls)
+	}
+	if info.Mode().Perm() != 0444 {
+		t.Errorf("Info: expected 0444, got %o", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,156 @@
+package rofs
+
+import (
+	"context"
+	"io/fs"
+	"sync"
+	"time"
+
+	"github.com/absfs/absfs"
+)
+
+// Freezer is a read-write FileSystem whose mutating operations can be
+// suspended, much like Linux fsfreeze. While frozen, operations such as
+// Create, Mkdir, Remove, Rename and File.Write block until Thaw is called or
+// until the context of the view they were called through is done, in which
+// case they fail with a *PathError wrapping the context's error. Reads are
+// never blocked.
+//
+// Use WithContext to bound how long the operations of a view may wait; views
+// without a context wait indefinitely.
+type Freezer struct {
+	*FileSystem
+}
+
+// FreezeStats reports on operations blocked by a Freezer.
+type FreezeStats struct {
+	// Waiting is the number of operations currently blocked.
+	Waiting int
+
+	// Longest is how long the operation that has been blocked the longest
+	// has been waiting so far. It is zero when nothing is waiting.
+	Longest time.Duration
+
+	// Waited is the number of operations that were blocked and have since
+	// resumed or given up.
+	Waited uint64
+
+	// WaitTime is the total time those operations spent blocked.
+	WaitTime time.Duration
+
+	// TimedOut is the number of operations that gave up because their
+	// context was done before Thaw.
+	TimedOut uint64
+}
+
+type freezeState struct {
+	mu      sync.Mutex
+	frozen  bool
+	thawed  chan struct{} // closed by Thaw
+	active  int           // mutating operations in progress
+	idle    *sync.Cond    // signalled when active drops to zero
+	waiters map[*time.Time]struct{}
+	stats   FreezeStats
+}
+
+// NewFreezer returns a thawed Freezer over fs.
+func NewFreezer(fs absfs.SymlinkFileSystem, opts ...Option) (*Freezer, error) {
+	f, err := NewFS(fs, opts...)
+	if err != nil {
+		return nil, err
+	}
+	z := &freezeState{waiters: make(map[*time.Time]struct{})}
+	z.idle = sync.NewCond(&z.mu)
+	f.fz = z
+	return &Freezer{f}, nil
+}
+
+// Freeze suspends mutating operations. It returns once every mutating
+// operation already in progress has completed, so the wrapped filesystem is
+// stable until Thaw is called.
+func (z *Freezer) Freeze() {
+	s := z.fz
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.frozen {
+		s.frozen = true
+		s.thawed = make(chan struct{})
+	}
+	for s.active > 0 {
+		s.idle.Wait()
+	}
+}
+
+// Thaw resumes mutating operations and releases every blocked operation.
+func (z *Freezer) Thaw() {
+	s := z.fz
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.frozen {
+		s.frozen = false
+		close(s.thawed)
+	}
+}
+
+// Frozen reports whether the filesystem is frozen.
+func (z *Freezer) Frozen() bool {
+	z.fz.mu.Lock()
+	defer z.fz.mu.Unlock()
+	return z.fz.frozen
+}
+
+// Stats returns statistics about blocked operations.
+func (z *Freezer) Stats() FreezeStats {
+	s := z.fz
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats
+	stats.Waiting = len(s.waiters)
+	now := time.Now()
+	for start := range s.waiters {
+		if d := now.Sub(*start); d > stats.Longest {
+			stats.Longest = d
+		}
+	}
+	return stats
+}
+
+// enter blocks while the filesystem is frozen and then registers a mutating
+// operation as in progress. The caller must call exit once it completes.
+func (s *freezeState) enter(ctx context.Context, op, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.frozen {
+		thawed := s.thawed
+		start := time.Now()
+		s.waiters[&start] = struct{}{}
+		s.mu.Unlock()
+
+		var err error
+		select {
+		case <-thawed:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+
+		s.mu.Lock()
+		delete(s.waiters, &start)
+		s.stats.Waited++
+		s.stats.WaitTime += time.Since(start)
+		if err != nil {
+			s.stats.TimedOut++
+			return &fs.PathError{Op: op, Path: name, Err: err}
+		}
+	}
+	s.active++
+	return nil
+}
+
+func (s *freezeState) exit() {
+	s.mu.Lock()
+	s.active--
+	if s.active == 0 {
+		s.idle.Broadcast()
+	}
+	s.mu.Unlock()
+}
@@ -0,0 +1,101 @@
+package rofs_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/absfs/ioutil"
+	"github.com/absfs/rofs"
+)
+
+func TestFreezer(t *testing.T) {
+	for _, b := range testBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			dir := path.Join(b.dir, "freeze")
+			mustMkdirAll(t, b.fs, dir)
+			mustWrite(t, b.fs, path.Join(dir, "data"), "data")
+
+			z, err := rofs.NewFreezer(b.fs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			view, err := z.SubFS(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w, err := view.Create("/log")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+
+			z.Freeze()
+			if !z.Frozen() {
+				t.Fatal("Freeze did not freeze")
+			}
+
+			// reads are not blocked
+			if data, err := view.ReadFile("/data"); err != nil || string(data) != "data" {
+				t.Errorf("ReadFile while frozen: got %q, %v", data, err)
+			}
+
+			// writes time out with the context of the view
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			if err := view.WithContext(ctx).Mkdir("/d", 0755); !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("Mkdir with expired context: got %v", err)
+			} else if pe := new(fs.PathError); !errors.As(err, &pe) || pe.Op != "mkdir" || pe.Path != "/d" {
+				t.Errorf("Mkdir error: got %#v", err)
+			}
+			if _, err := b.fs.Stat(path.Join(dir, "d")); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("Mkdir reached the backend while frozen: %v", err)
+			}
+
+			// and block until Thaw without one
+			results := make(chan error, 3)
+			go func() { results <- view.Mkdir("/d", 0755) }()
+			go func() { results <- view.Rename("/data", "/moved") }()
+			go func() {
+				_, err := w.WriteString("entry")
+				results <- err
+			}()
+
+			deadline := time.Now().Add(time.Second)
+			for z.Stats().Waiting != 3 && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			stats := z.Stats()
+			if stats.Waiting != 3 || stats.Longest <= 0 {
+				t.Fatalf("Stats while blocked: %+v", stats)
+			}
+			select {
+			case err := <-results:
+				t.Fatalf("operation completed while frozen: %v", err)
+			default:
+			}
+
+			z.Thaw()
+			for i := 0; i < 3; i++ {
+				if err := <-results; err != nil {
+					t.Errorf("operation after Thaw: %v", err)
+				}
+			}
+
+			stats = z.Stats()
+			if stats.Waiting != 0 || stats.Waited != 4 || stats.TimedOut != 1 || stats.WaitTime <= 0 {
+				t.Errorf("Stats after Thaw: %+v", stats)
+			}
+			if _, err := b.fs.Stat(path.Join(dir, "d")); err != nil {
+				t.Error(err)
+			}
+			if data, err := ioutil.ReadFile(b.fs, path.Join(dir, "moved")); err != nil || string(data) != "data" {
+				t.Errorf("renamed file: got %q, %v", data, err)
+			}
+		})
+	}
+}
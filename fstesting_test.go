@@ -2,8 +2,9 @@ package rofs_test
 
 import (
 	"bytes"
+	"errors"
 	"io"
-	"os"
+	"io/fs"
 	"path/filepath"
 	"testing"
 	"time"
@@ -16,7 +17,8 @@ import (
 // TestWrapperSuite tests rofs using fstesting.WrapperSuite.
 // Note: WrapperSuite has limitations with ReadOnly wrappers (it tries to
 // create test directories even when ReadOnly is true), so we run our own
-// custom wrapper tests instead.
+// custom wrapper tests instead. The complete read-only contract is checked by
+// the exported rofstest.Suite, run in the rofstest package.
 func TestWrapperSuite(t *testing.T) {
 	baseFS, err := memfs.NewFS()
 	if err != nil {
@@ -113,7 +115,7 @@ func TestWrapperSuite(t *testing.T) {
 				if err == nil {
 					t.Errorf("%s should fail for read-only wrapper", tt.name)
 				}
-				if !os.IsPermission(err) {
+				if !errors.Is(err, fs.ErrPermission) {
 					t.Errorf("%s: expected permission error, got %v", tt.name, err)
 				}
 			})
@@ -0,0 +1,175 @@
+package rofs
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// IOFS presents a FileSystem through the io/fs interfaces. It implements
+// fs.FS, fs.StatFS, fs.ReadDirFS, fs.ReadFileFS, fs.GlobFS, fs.SubFS and
+// fs.ReadLinkFS, so a read-only view can be handed directly to http.FS,
+// template.ParseFS and similar consumers.
+//
+// Names are validated with fs.ValidPath and interpreted relative to the root
+// of the FileSystem, not its working directory. Names containing a backslash
+// are rejected as well, because absfs backends may treat it as a separator.
+// The FileSystem type itself cannot implement fs.FS because its Open method
+// returns an absfs.File as required by absfs.FileSystem.
+type IOFS struct {
+	fsys *FileSystem
+}
+
+var (
+	_ fs.FS         = (*IOFS)(nil)
+	_ fs.StatFS     = (*IOFS)(nil)
+	_ fs.ReadDirFS  = (*IOFS)(nil)
+	_ fs.ReadFileFS = (*IOFS)(nil)
+	_ fs.GlobFS     = (*IOFS)(nil)
+	_ fs.SubFS      = (*IOFS)(nil)
+)
+
+// IOFS returns an io/fs view of f rooted at the root of f.
+func (f *FileSystem) IOFS() *IOFS {
+	return &IOFS{fsys: f}
+}
+
+// FileSystem returns the FileSystem the IOFS reads from.
+func (i *IOFS) FileSystem() *FileSystem {
+	return i.fsys
+}
+
+// name maps an io/fs name to an absolute name in the underlying view.
+func (i *IOFS) name(op, name string) (string, error) {
+	if !fs.ValidPath(name) || strings.Contains(name, `\`) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return path.Join("/", name), nil
+}
+
+// pathErr rewrites the path of a *fs.PathError to the io/fs name the caller
+// used.
+func pathErr(err error, name string) error {
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		return &fs.PathError{Op: pe.Op, Path: name, Err: pe.Err}
+	}
+	return err
+}
+
+// Open opens the named file for reading.
+func (i *IOFS) Open(name string) (fs.File, error) {
+	full, err := i.name("open", name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := i.fsys.Open(full)
+	if err != nil {
+		return nil, pathErr(err, name)
+	}
+	return f, nil
+}
+
+// Stat returns a FileInfo describing the named file.
+func (i *IOFS) Stat(name string) (fs.FileInfo, error) {
+	full, err := i.name("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := i.fsys.Stat(full)
+	if err != nil {
+		return nil, pathErr(err, name)
+	}
+	return info, nil
+}
+
+// Lstat returns a FileInfo describing the named file without following a
+// final symbolic link.
+func (i *IOFS) Lstat(name string) (fs.FileInfo, error) {
+	full, err := i.name("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := i.fsys.Lstat(full)
+	if err != nil {
+		return nil, pathErr(err, name)
+	}
+	return info, nil
+}
+
+// ReadLink returns the destination of the named symbolic link.
+func (i *IOFS) ReadLink(name string) (string, error) {
+	full, err := i.name("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	info, err := i.fsys.Lstat(full)
+	if err != nil {
+		return "", pathErr(err, name)
+	}
+	if info.Mode()&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	target, err := i.fsys.Readlink(full)
+	if err != nil {
+		return "", pathErr(err, name)
+	}
+	return target, nil
+}
+
+// ReadDir reads the named directory and returns its entries sorted by
+// filename.
+func (i *IOFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	full, err := i.name("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := i.fsys.ReadDir(full)
+	if err != nil {
+		return nil, pathErr(err, name)
+	}
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].Name() < entries[b].Name()
+	})
+	return entries, nil
+}
+
+// ReadFile reads the named file and returns its contents.
+func (i *IOFS) ReadFile(name string) ([]byte, error) {
+	full, err := i.name("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := i.fsys.ReadFile(full)
+	if err != nil {
+		return nil, pathErr(err, name)
+	}
+	return data, nil
+}
+
+// Glob returns the names of all files matching pattern.
+func (i *IOFS) Glob(pattern string) ([]string, error) {
+	// fs.Glob would call back into this method if given i directly.
+	return fs.Glob(globFS{i}, pattern)
+}
+
+// globFS hides the Glob method of an IOFS so fs.Glob falls back to its
+// generic implementation.
+type globFS struct {
+	fs.ReadDirFS
+}
+
+// Sub returns an IOFS rooted at dir.
+func (i *IOFS) Sub(dir string) (fs.FS, error) {
+	full, err := i.name("sub", dir)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := i.fsys.SubFS(full)
+	if err != nil {
+		return nil, pathErr(err, dir)
+	}
+	return sub.IOFS(), nil
+}
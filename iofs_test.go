@@ -0,0 +1,123 @@
+package rofs_test
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"testing"
+	"testing/fstest"
+
+	"github.com/absfs/rofs"
+)
+
+// readLinkFS mirrors fs.ReadLinkFS, which is newer than the module's minimum
+// Go version.
+type readLinkFS interface {
+	fs.FS
+	ReadLink(name string) (string, error)
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+var _ readLinkFS = (*rofs.IOFS)(nil)
+
+func TestIOFS(t *testing.T) {
+	for _, b := range testBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			root := path.Join(b.dir, "iofs")
+			mustMkdirAll(t, b.fs, path.Join(root, "dir", "sub"))
+			mustWrite(t, b.fs, path.Join(root, "a.txt"), "alpha")
+			mustWrite(t, b.fs, path.Join(root, "dir", "b.txt"), "bravo")
+			mustWrite(t, b.fs, path.Join(root, "dir", "sub", "c.tmpl"), "charlie")
+
+			rfs, err := rofs.NewFS(b.fs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sub, err := rfs.SubFS(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fsys := sub.IOFS()
+
+			t.Run("fstest", func(t *testing.T) {
+				if err := fstest.TestFS(fsys, "a.txt", "dir/b.txt", "dir/sub/c.tmpl"); err != nil {
+					t.Fatal(err)
+				}
+			})
+
+			t.Run("Sub through FileSystem", func(t *testing.T) {
+				fsys, err := rfs.Sub(root)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := fstest.TestFS(fsys, "a.txt", "dir/b.txt"); err != nil {
+					t.Fatal(err)
+				}
+			})
+
+			t.Run("invalid paths", func(t *testing.T) {
+				for _, name := range []string{"/a.txt", "../a.txt", "dir/../a.txt", "./a.txt", ""} {
+					if _, err := fsys.Open(name); !errors.Is(err, fs.ErrInvalid) {
+						t.Errorf("Open(%q): expected fs.ErrInvalid, got %v", name, err)
+					}
+					if _, err := fsys.Stat(name); !errors.Is(err, fs.ErrInvalid) {
+						t.Errorf("Stat(%q): expected fs.ErrInvalid, got %v", name, err)
+					}
+				}
+			})
+
+			t.Run("errors use io/fs names", func(t *testing.T) {
+				_, err := fsys.ReadFile("dir/missing.txt")
+				var pathErr *fs.PathError
+				if !errors.As(err, &pathErr) {
+					t.Fatalf("expected *fs.PathError, got %T %v", err, err)
+				}
+				if pathErr.Path != "dir/missing.txt" {
+					t.Errorf("PathError.Path: expected 'dir/missing.txt', got %q", pathErr.Path)
+				}
+				if !errors.Is(err, fs.ErrNotExist) {
+					t.Errorf("expected fs.ErrNotExist, got %v", err)
+				}
+			})
+
+			t.Run("Glob", func(t *testing.T) {
+				matches, err := fs.Glob(fsys, "dir/*.txt")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(matches) != 1 || matches[0] != "dir/b.txt" {
+					t.Errorf("Glob: expected [dir/b.txt], got %v", matches)
+				}
+				if _, err := fsys.Glob("["); !errors.Is(err, path.ErrBadPattern) {
+					t.Errorf("Glob bad pattern: expected ErrBadPattern, got %v", err)
+				}
+			})
+
+			t.Run("ReadLink", func(t *testing.T) {
+				if err := b.fs.Symlink("a.txt", path.Join(root, "link")); err != nil {
+					t.Fatal(err)
+				}
+				target, err := fsys.ReadLink("link")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if target != "a.txt" {
+					t.Errorf("ReadLink: expected 'a.txt', got %q", target)
+				}
+				info, err := fsys.Lstat("link")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Mode()&fs.ModeSymlink == 0 {
+					t.Errorf("Lstat: expected symlink, got %s", info.Mode())
+				}
+				if _, err := fsys.ReadLink("a.txt"); err == nil {
+					t.Error("ReadLink on a regular file: expected error")
+				}
+				if err := fstest.TestFS(fsys, "a.txt", "link"); err != nil {
+					t.Fatal(err)
+				}
+			})
+		})
+	}
+}
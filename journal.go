@@ -0,0 +1,395 @@
+package rofs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/absfs/absfs"
+)
+
+// Journal is a FileSystem that accepts every mutating operation without
+// touching the wrapped filesystem and appends it to a journal file kept on a
+// separate filesystem, so that the changes can be applied later with Replay,
+// for example in a maintenance window. Reads reflect the journaled changes,
+// which are held in memory like those of a DryRun.
+//
+// Each entry is written as a line of JSON and synced before the change is
+// applied to the view, so that the view never shows a change the journal
+// lacks. If the entry cannot be written, the operation fails without
+// changing the view, and so does every later one, since the journal may or
+// may not hold the entry. The first time an entry touches a path of the
+// wrapped filesystem, it records the state the path had, so that Replay can
+// detect paths that have changed since.
+type Journal struct {
+	*FileSystem
+	ov   *overlay
+	fsys absfs.FileSystem
+	name string
+
+	// file, err and touched are guarded by ov.mu. err is the error an entry
+	// failed to be written with. touched holds the paths changed by earlier
+	// entries.
+	file    absfs.File
+	err     error
+	touched map[string]bool
+}
+
+// A JournalEntry is an operation stored in a journal.
+type JournalEntry struct {
+	Action
+
+	// Data holds the bytes of a write.
+	Data []byte `json:"data,omitempty"`
+
+	// Base is the state of Path, and TargetBase that of the Target of a
+	// rename, on the wrapped filesystem when the entry was journaled. They
+	// are only recorded for the first entry touching a path.
+	Base       *FileState `json:"base,omitempty"`
+	TargetBase *FileState `json:"target_base,omitempty"`
+}
+
+// FileState is the state of a path that Replay compares to detect conflicts.
+// For directories only the existence and type are compared; for other files
+// the size and modification time as well.
+type FileState struct {
+	Exists  bool        `json:"exists"`
+	Mode    fs.FileMode `json:"mode,omitempty"`
+	Size    int64       `json:"size,omitempty"`
+	ModTime time.Time   `json:"mtime"`
+}
+
+func stateOf(info os.FileInfo, err error) FileState {
+	if err != nil {
+		return FileState{}
+	}
+	return FileState{Exists: true, Mode: info.Mode(), Size: info.Size(), ModTime: info.ModTime()}
+}
+
+func (s FileState) matches(t FileState) bool {
+	switch {
+	case s.Exists != t.Exists:
+		return false
+	case !s.Exists:
+		return true
+	case s.Mode.Type() != t.Mode.Type():
+		return false
+	case s.Mode.IsDir():
+		return true
+	}
+	return s.Size == t.Size && s.ModTime.Equal(t.ModTime)
+}
+
+func (s FileState) String() string {
+	switch {
+	case !s.Exists:
+		return "missing"
+	case s.Mode.IsDir():
+		return "directory"
+	}
+	return fmt.Sprintf("%v, %d bytes, modified %s", s.Mode, s.Size, s.ModTime.Format(time.RFC3339Nano))
+}
+
+// ErrConflict is matched by the errors Replay reports for entries it did not
+// apply because the destination changed since they were journaled.
+var ErrConflict = errors.New("path changed since the operation was journaled")
+
+// ConflictError reports a journal entry that was not applied because the
+// state of Path on the destination differs from the state it had when the
+// entry was journaled.
+type ConflictError struct {
+	Op   string
+	Path string
+	Want FileState
+	Got  FileState
+}
+
+func (e *ConflictError) Error() string {
+	return e.Op + " " + e.Path + ": " + ErrConflict.Error() + ": was " + e.Want.String() + ", is " + e.Got.String()
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// ReplayResult is the outcome of replaying one journal entry. Err is nil if
+// the entry was applied. Entries touching a path, or a directory above or
+// below a path, for which an earlier entry failed are skipped, and their
+// Err wraps the earlier error.
+type ReplayResult struct {
+	Entry JournalEntry
+	Err   error
+}
+
+// NewJournal returns a Journal over fs that appends to the journal file name
+// on journal. If the file exists, its entries are applied to the view first,
+// so that a journal can be continued after a restart; NewJournal fails if one
+// of them cannot be applied.
+func NewJournal(fs absfs.SymlinkFileSystem, journal absfs.FileSystem, name string, opts ...Option) (*Journal, error) {
+	f, err := newFS(fs, opts)
+	if err != nil {
+		return nil, err
+	}
+	ov, err := newOverlay(fs, f.opts.scratch)
+	if err != nil {
+		return nil, err
+	}
+	f.fs, f.ov = ov, ov
+	j := &Journal{FileSystem: f, ov: ov, fsys: journal, name: name, touched: make(map[string]bool)}
+
+	entries, err := ReadJournal(journal, name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, r := range Replay(entries, ov) {
+		if r.Err != nil {
+			return nil, fmt.Errorf("rofs: journal %s does not apply: %w", name, r.Err)
+		}
+		j.touch(r.Entry.Action)
+	}
+
+	j.file, err = journal.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	ov.log = j.append
+	return j, nil
+}
+
+// Close closes the journal file. Mutating operations fail afterwards.
+func (j *Journal) Close() error {
+	j.ov.mu.Lock()
+	defer j.ov.mu.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// Entries returns the entries of the journal file.
+func (j *Journal) Entries() ([]JournalEntry, error) {
+	return ReadJournal(j.fsys, j.name)
+}
+
+// Replay applies the entries of the journal file to dst, which should be the
+// filesystem the Journal wraps or a copy of it. See the package function
+// Replay. The journal file is left as it is.
+func (j *Journal) Replay(dst absfs.FileSystem) ([]ReplayResult, error) {
+	entries, err := j.Entries()
+	if err != nil {
+		return nil, err
+	}
+	return Replay(entries, dst), nil
+}
+
+// append writes an entry for a to the journal file. It is called with ov.mu
+// held.
+func (j *Journal) append(a Action, data []byte) error {
+	if j.file == nil {
+		return &fs.PathError{Op: a.Op, Path: a.Path, Err: fs.ErrClosed}
+	}
+	if j.err != nil {
+		return &fs.PathError{Op: a.Op, Path: a.Path, Err: j.err}
+	}
+	e := JournalEntry{Action: a, Data: data}
+	if !j.controlled(a.Path) {
+		st := stateOf(j.ov.lower.Lstat(a.Path))
+		e.Base = &st
+	}
+	if a.Op == "rename" && !j.controlled(a.Target) {
+		st := stateOf(j.ov.lower.Lstat(a.Target))
+		e.TargetBase = &st
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		j.err = underlying(err)
+		return err
+	}
+	if err := j.file.Sync(); err != nil {
+		j.err = underlying(err)
+		return err
+	}
+	j.touch(a)
+	return nil
+}
+
+// touch marks the paths changed by a.
+func (j *Journal) touch(a Action) {
+	j.touched[a.Path] = true
+	if a.Op == "rename" {
+		j.touched[a.Target] = true
+	}
+}
+
+// controlled reports whether p, or a directory above it, has been changed by
+// an earlier entry, so that its state no longer comes from the wrapped
+// filesystem.
+func (j *Journal) controlled(p string) bool {
+	for {
+		if j.touched[p] {
+			return true
+		}
+		if p == "/" {
+			return false
+		}
+		p = path.Dir(p)
+	}
+}
+
+// ReadJournal reads the entries of the journal file name on fsys. A last
+// line that was cut short, as happens when the process stops while writing
+// it, is ignored.
+func ReadJournal(fsys absfs.FileSystem, name string) ([]JournalEntry, error) {
+	data, err := fsys.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var entries []JournalEntry
+	for n := 1; len(data) > 0; n++ {
+		line, rest, complete := bytes.Cut(data, []byte("\n"))
+		data = rest
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var e JournalEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			if !complete {
+				break
+			}
+			return entries, fmt.Errorf("rofs: journal %s, line %d: %w", name, n, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Replay applies entries to dst in order and reports the outcome of each.
+// Before an entry with a recorded base state is applied, the state of its
+// paths on dst is compared with it, and the entry fails with a
+// *ConflictError if they differ.
+func Replay(entries []JournalEntry, dst absfs.FileSystem) []ReplayResult {
+	results := make([]ReplayResult, 0, len(entries))
+	failed := make(map[string]error)
+	for _, e := range entries {
+		paths := []string{e.Path}
+		if e.Op == "rename" {
+			paths = append(paths, e.Target)
+		}
+		r := ReplayResult{Entry: e}
+		if p, err := failedAt(failed, paths); err != nil {
+			r.Err = fmt.Errorf("%s %s: skipped after failure on %s: %w", e.Op, e.Path, p, err)
+		} else if r.Err = checkBase(dst, e.Op, e.Path, e.Base); r.Err == nil {
+			if r.Err = checkBase(dst, e.Op, e.Target, e.TargetBase); r.Err == nil {
+				r.Err = applyEntry(dst, e)
+			}
+		}
+		if r.Err != nil {
+			for _, p := range paths {
+				if _, ok := failed[p]; !ok {
+					failed[p] = r.Err
+				}
+			}
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// failedAt returns a failed path that is one of paths, or above or below one
+// of them, with its error.
+func failedAt(failed map[string]error, paths []string) (string, error) {
+	for q, err := range failed {
+		for _, p := range paths {
+			if p == q || strings.HasPrefix(p, q+"/") || strings.HasPrefix(q, p+"/") || p == "/" || q == "/" {
+				return q, err
+			}
+		}
+	}
+	return "", nil
+}
+
+func checkBase(dst absfs.FileSystem, op, p string, want *FileState) error {
+	if want == nil {
+		return nil
+	}
+	var got FileState
+	if l, ok := dst.(interface {
+		Lstat(string) (os.FileInfo, error)
+	}); ok {
+		got = stateOf(l.Lstat(p))
+	} else {
+		got = stateOf(dst.Stat(p))
+	}
+	if !want.matches(got) {
+		return &ConflictError{Op: op, Path: p, Want: *want, Got: got}
+	}
+	return nil
+}
+
+func applyEntry(dst absfs.FileSystem, e JournalEntry) error {
+	switch e.Op {
+	case "create", "write":
+		flag := os.O_WRONLY
+		if e.Op == "create" {
+			flag |= os.O_CREATE | os.O_TRUNC
+		}
+		f, err := dst.OpenFile(e.Path, flag, e.Mode)
+		if err != nil {
+			return err
+		}
+		if len(e.Data) > 0 {
+			_, err = f.WriteAt(e.Data, e.Offset)
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	case "truncate":
+		return dst.Truncate(e.Path, e.Size)
+	case "mkdir":
+		return dst.Mkdir(e.Path, e.Mode)
+	case "remove":
+		return dst.Remove(e.Path)
+	case "removeall":
+		return dst.RemoveAll(e.Path)
+	case "rename":
+		return dst.Rename(e.Path, e.Target)
+	case "chmod":
+		return dst.Chmod(e.Path, e.Mode)
+	case "chtimes":
+		if e.Atime == nil || e.Mtime == nil {
+			break
+		}
+		return dst.Chtimes(e.Path, *e.Atime, *e.Mtime)
+	case "chown", "lchown":
+		if e.UID == nil || e.GID == nil {
+			break
+		}
+		if e.Op == "chown" {
+			return dst.Chown(e.Path, *e.UID, *e.GID)
+		}
+		if l, ok := dst.(absfs.SymLinker); ok {
+			return l.Lchown(e.Path, *e.UID, *e.GID)
+		}
+		return &fs.PathError{Op: e.Op, Path: e.Path, Err: ErrNotSupported}
+	case "symlink":
+		if l, ok := dst.(absfs.SymLinker); ok {
+			return l.Symlink(e.Target, e.Path)
+		}
+		return &os.LinkError{Op: e.Op, Old: e.Target, New: e.Path, Err: ErrNotSupported}
+	}
+	return &fs.PathError{Op: e.Op, Path: e.Path, Err: errInvalidEntry}
+}
+
+var errInvalidEntry = errors.New("invalid journal entry")
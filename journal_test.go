@@ -0,0 +1,283 @@
+package rofs_test
+
+import (
+	"errors"
+	"os"
+	"path"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/ioutil"
+	"github.com/absfs/memfs"
+	"github.com/absfs/rofs"
+)
+
+func TestJournal(t *testing.T) {
+	for _, b := range testBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			dir := path.Join(b.dir, "journal")
+			mustMkdirAll(t, b.fs, path.Join(dir, "old"))
+			mustWrite(t, b.fs, path.Join(dir, "config"), "v1\n")
+			mustWrite(t, b.fs, path.Join(dir, "old", "a"), "a")
+			mustWrite(t, b.fs, path.Join(dir, "log"), "0123456789")
+			before := tree(t, b.fs, dir)
+
+			jfs, err := memfs.NewFS()
+			if err != nil {
+				t.Fatal(err)
+			}
+			j, err := rofs.NewJournal(b.fs, jfs, "/changes.jsonl")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(j, path.Join(dir, "config"), []byte("v2\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			f, err := j.OpenFile(path.Join(dir, "log"), os.O_RDWR, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.WriteAt([]byte("AB"), 4); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.Truncate(8); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err := j.Mkdir(path.Join(dir, "new"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := j.Rename(path.Join(dir, "old", "a"), path.Join(dir, "new", "a")); err != nil {
+				t.Fatal(err)
+			}
+			if err := j.Remove(path.Join(dir, "old")); err != nil {
+				t.Fatal(err)
+			}
+
+			want := map[string]string{
+				"config": "v2\n",
+				"log":    "0123AB67",
+				"new":    "<dir>",
+				"new/a":  "a",
+			}
+			if got := tree(t, j, dir); !reflect.DeepEqual(got, want) {
+				t.Errorf("journaled view:\ngot  %v\nwant %v", got, want)
+			}
+			if got := tree(t, b.fs, dir); !reflect.DeepEqual(got, before) {
+				t.Errorf("backend changed:\nbefore %v\nafter  %v", before, got)
+			}
+			if err := j.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err := j.Chmod(path.Join(dir, "config"), 0600); err == nil {
+				t.Error("Chmod after Close succeeded")
+			}
+
+			// a process restarting with the same journal sees its changes
+			j, err = rofs.NewJournal(b.fs, jfs, "/changes.jsonl")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer j.Close()
+			if got := tree(t, j, dir); !reflect.DeepEqual(got, want) {
+				t.Errorf("reopened journal:\ngot  %v\nwant %v", got, want)
+			}
+
+			results, err := j.Replay(b.fs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range results {
+				if r.Err != nil {
+					t.Errorf("%s: %v", r.Entry.Action, r.Err)
+				}
+			}
+			if got := tree(t, b.fs, dir); !reflect.DeepEqual(got, want) {
+				t.Errorf("replayed backend:\ngot  %v\nwant %v", got, want)
+			}
+		})
+	}
+}
+
+func TestJournalConflict(t *testing.T) {
+	for _, b := range testBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			dir := path.Join(b.dir, "journal-conflict")
+			mustMkdirAll(t, b.fs, dir)
+			mustWrite(t, b.fs, path.Join(dir, "a"), "a")
+			mustWrite(t, b.fs, path.Join(dir, "b"), "b")
+
+			jfs, err := memfs.NewFS()
+			if err != nil {
+				t.Fatal(err)
+			}
+			j, err := rofs.NewJournal(b.fs, jfs, "/changes.jsonl")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer j.Close()
+			mustWrite(t, j, path.Join(dir, "a"), "journaled a")
+			if err := j.Rename(path.Join(dir, "a"), path.Join(dir, "c")); err != nil {
+				t.Fatal(err)
+			}
+			mustWrite(t, j, path.Join(dir, "b"), "journaled b")
+
+			// someone else changes a in the meantime
+			mustWrite(t, b.fs, path.Join(dir, "a"), "changed a")
+
+			results, err := j.Replay(b.fs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ops []string
+			for _, r := range results {
+				switch r.Entry.Path {
+				case path.Join(dir, "a"):
+					if !errors.Is(r.Err, rofs.ErrConflict) {
+						t.Errorf("%s: got %v, want a conflict", r.Entry.Action, r.Err)
+					}
+					var ce *rofs.ConflictError
+					if r.Entry.Base != nil && !errors.As(r.Err, &ce) {
+						t.Errorf("%s: got %T, want *ConflictError", r.Entry.Action, r.Err)
+					}
+				case path.Join(dir, "b"):
+					if r.Err != nil {
+						t.Errorf("%s: %v", r.Entry.Action, r.Err)
+					}
+				}
+				ops = append(ops, r.Entry.Op)
+			}
+			if len(ops) == 0 {
+				t.Fatal("no entries replayed")
+			}
+			if got := readString(t, b.fs, path.Join(dir, "a")); got != "changed a" {
+				t.Errorf("conflicting path overwritten: %q", got)
+			}
+			if _, err := b.fs.Stat(path.Join(dir, "c")); err == nil {
+				t.Error("rename after a conflict was applied")
+			}
+			if got := readString(t, b.fs, path.Join(dir, "b")); got != "journaled b" {
+				t.Errorf("b = %q, want the journaled content", got)
+			}
+		})
+	}
+}
+
+func TestReadJournalPartialLine(t *testing.T) {
+	jfs, err := memfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, jfs, "/j", `{"op":"mkdir","path":"/x","mode":2147484141}`+"\n"+`{"op":"write","pa`)
+	entries, err := rofs.ReadJournal(jfs, "/j")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Op != "mkdir" || entries[0].Path != "/x" {
+		t.Errorf("entries = %+v", entries)
+	}
+
+	mustWrite(t, jfs, "/j", `{"op":"write","pa`+"\n"+`{"op":"mkdir","path":"/x"}`+"\n")
+	if _, err := rofs.ReadJournal(jfs, "/j"); err == nil {
+		t.Error("corrupt line in the middle of the journal accepted")
+	}
+}
+
+func readString(t *testing.T, fs absfs.FileSystem, name string) string {
+	t.Helper()
+	data, err := fs.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// failingFS is a filesystem whose files fail to sync while fail is set.
+type failingFS struct {
+	absfs.FileSystem
+	fail *bool
+}
+
+type failingFile struct {
+	absfs.File
+	fail *bool
+}
+
+func (f failingFS) OpenFile(name string, flag int, perm os.FileMode) (absfs.File, error) {
+	file, err := f.FileSystem.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return failingFile{file, f.fail}, nil
+}
+
+func (f failingFile) Sync() error {
+	if *f.fail {
+		return syscall.EIO
+	}
+	return f.File.Sync()
+}
+
+func TestJournalWriteFailure(t *testing.T) {
+	lower, err := memfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, lower, "/config", "v1\n")
+	mem, err := memfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fail := false
+	j, err := rofs.NewJournal(lower, failingFS{mem, &fail}, "/changes.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Mkdir("/kept", 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := j.OpenFile("/config", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	fail = true
+	if _, err := f.WriteString("v2\n"); !errors.Is(err, syscall.EIO) {
+		t.Errorf("Write: got %v, want EIO", err)
+	}
+	fail = false
+	// the journal may hold the failed entry, so nothing is accepted anymore
+	if err := j.Mkdir("/lost", 0755); !errors.Is(err, syscall.EIO) {
+		t.Errorf("Mkdir after the failure: got %v, want EIO", err)
+	}
+	for _, tt := range []struct {
+		name string
+		err  error
+	}{
+		{"Truncate", j.Truncate("/config", 0)},
+		{"Remove", j.Remove("/kept")},
+		{"Rename", j.Rename("/kept", "/moved")},
+		{"Symlink", j.Symlink("config", "/link")},
+	} {
+		if tt.err == nil {
+			t.Errorf("%s after the failure succeeded", tt.name)
+		}
+	}
+
+	if got := readString(t, j, "/config"); got != "v1\n" {
+		t.Errorf("config = %q, the failed write shows in the view", got)
+	}
+	for _, name := range []string{"/lost", "/moved", "/link"} {
+		if _, err := j.Lstat(name); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Lstat(%s): got %v, want ErrNotExist", name, err)
+		}
+	}
+	if _, err := j.Stat("/kept"); err != nil {
+		t.Errorf("Stat(/kept): %v", err)
+	}
+}
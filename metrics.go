@@ -0,0 +1,246 @@
+package rofs
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metrics collects traffic metrics of one or more views, each labelled with
+// a mount name, and exposes them in the Prometheus text format through
+// ServeHTTP and as JSON through expvar:
+//
+//	m := rofs.NewMetrics()
+//	assets, err := rofs.NewFS(backend, rofs.WithObserver(m.Observer("assets")))
+//	http.Handle("/metrics", m)
+//	expvar.Publish("rofs", m)
+//
+// For each mount it counts opens, stats and directory reads, the bytes read
+// through File.Read and File.ReadAt, the files currently open and the
+// operations denied as read-only, by operation, and keeps a histogram of the
+// latency of every operation.
+type Metrics struct {
+	mu     sync.Mutex
+	mounts map[string]*mountMetrics
+}
+
+type mountMetrics struct {
+	opens, stats, readdirs uint64
+	readBytes              int64
+	openHandles            int64
+	denied                 map[string]uint64
+	latency                map[string]*histogram
+}
+
+// latencyBuckets are the upper bounds, in seconds, of the latency histogram
+// buckets.
+var latencyBuckets = []float64{
+	0.00001, 0.000025, 0.00005, 0.0001, 0.00025, 0.0005,
+	0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10,
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, the last one for +Inf
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(v float64) {
+	i := sort.SearchFloat64s(latencyBuckets, v)
+	h.counts[i]++
+	h.count++
+	h.sum += v
+}
+
+// NewMetrics returns an empty Metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{mounts: make(map[string]*mountMetrics)}
+}
+
+// Observer returns the Observer to give to the views of mount with
+// WithObserver. Views given the same mount share its metrics.
+func (m *Metrics) Observer(mount string) Observer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.mounts[mount] == nil {
+		m.mounts[mount] = &mountMetrics{denied: make(map[string]uint64), latency: make(map[string]*histogram)}
+	}
+	return metricsObserver{m, mount}
+}
+
+type metricsObserver struct {
+	m     *Metrics
+	mount string
+}
+
+func (o metricsObserver) Before(*Event) {}
+
+func (o metricsObserver) After(e *Event) {
+	o.m.mu.Lock()
+	defer o.m.mu.Unlock()
+	mm := o.m.mounts[o.mount]
+	switch e.Op {
+	case "open":
+		mm.opens++
+		if e.Err == nil {
+			mm.openHandles++
+		}
+	case "close":
+		if e.Err == nil {
+			mm.openHandles--
+		}
+	case "stat", "lstat":
+		mm.stats++
+	case "readdir":
+		mm.readdirs++
+	case "read":
+		mm.readBytes += e.Bytes
+	}
+	if e.Err != nil && errors.Is(e.Err, ErrReadOnly) {
+		mm.denied[e.Op]++
+	}
+	h := mm.latency[e.Op]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets)+1)}
+		mm.latency[e.Op] = h
+	}
+	h.observe(e.Duration.Seconds())
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the metrics to w in the Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mounts := make([]string, 0, len(m.mounts))
+	for mount := range m.mounts {
+		mounts = append(mounts, mount)
+	}
+	sort.Strings(mounts)
+
+	cw := &countWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	counter := func(name, help string, value func(*mountMetrics) int64) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+		for _, mount := range mounts {
+			fmt.Fprintf(bw, "%s{mount=%s} %d\n", name, labelValue(mount), value(m.mounts[mount]))
+		}
+	}
+	counter("rofs_opens_total", "Files opened.", func(mm *mountMetrics) int64 { return int64(mm.opens) })
+	counter("rofs_stats_total", "Stat and Lstat calls.", func(mm *mountMetrics) int64 { return int64(mm.stats) })
+	counter("rofs_readdirs_total", "Directory reads.", func(mm *mountMetrics) int64 { return int64(mm.readdirs) })
+	counter("rofs_read_bytes_total", "Bytes read from open files.", func(mm *mountMetrics) int64 { return mm.readBytes })
+
+	fmt.Fprintf(bw, "# HELP rofs_open_handles Files currently open.\n# TYPE rofs_open_handles gauge\n")
+	for _, mount := range mounts {
+		fmt.Fprintf(bw, "rofs_open_handles{mount=%s} %d\n", labelValue(mount), m.mounts[mount].openHandles)
+	}
+
+	fmt.Fprintf(bw, "# HELP rofs_denied_total Operations denied as read-only.\n# TYPE rofs_denied_total counter\n")
+	for _, mount := range mounts {
+		mm := m.mounts[mount]
+		for _, op := range sortedKeys(mm.denied) {
+			fmt.Fprintf(bw, "rofs_denied_total{mount=%s,op=%s} %d\n", labelValue(mount), labelValue(op), mm.denied[op])
+		}
+	}
+
+	fmt.Fprintf(bw, "# HELP rofs_operation_duration_seconds Latency of operations.\n# TYPE rofs_operation_duration_seconds histogram\n")
+	for _, mount := range mounts {
+		mm := m.mounts[mount]
+		for _, op := range sortedKeys(mm.latency) {
+			h := mm.latency[op]
+			labels := "mount=" + labelValue(mount) + ",op=" + labelValue(op)
+			var cum uint64
+			for i, le := range latencyBuckets {
+				cum += h.counts[i]
+				fmt.Fprintf(bw, "rofs_operation_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels, strconv.FormatFloat(le, 'g', -1, 64), cum)
+			}
+			fmt.Fprintf(bw, "rofs_operation_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+			fmt.Fprintf(bw, "rofs_operation_duration_seconds_sum{%s} %s\n", labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+			fmt.Fprintf(bw, "rofs_operation_duration_seconds_count{%s} %d\n", labels, h.count)
+		}
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// String returns the metrics as a JSON object keyed by mount, so that a
+// Metrics can be published with expvar.Publish.
+func (m *Metrics) String() string {
+	type latency struct {
+		Count   uint64  `json:"count"`
+		Seconds float64 `json:"seconds"`
+	}
+	type mount struct {
+		Opens       uint64             `json:"opens"`
+		Stats       uint64             `json:"stats"`
+		Readdirs    uint64             `json:"readdirs"`
+		ReadBytes   int64              `json:"read_bytes"`
+		OpenHandles int64              `json:"open_handles"`
+		Denied      map[string]uint64  `json:"denied"`
+		Latency     map[string]latency `json:"latency"`
+	}
+	m.mu.Lock()
+	out := make(map[string]mount, len(m.mounts))
+	for name, mm := range m.mounts {
+		v := mount{
+			Opens: mm.opens, Stats: mm.stats, Readdirs: mm.readdirs,
+			ReadBytes: mm.readBytes, OpenHandles: mm.openHandles,
+			Denied:  make(map[string]uint64, len(mm.denied)),
+			Latency: make(map[string]latency, len(mm.latency)),
+		}
+		for op, n := range mm.denied {
+			v.Denied[op] = n
+		}
+		for op, h := range mm.latency {
+			v.Latency[op] = latency{h.count, h.sum}
+		}
+		out[name] = v
+	}
+	m.mu.Unlock()
+	data, err := json.Marshal(out)
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelValue quotes s as a Prometheus label value.
+func labelValue(s string) string {
+	return `"` + labelEscaper.Replace(s) + `"`
+}
+
+// countWriter counts the bytes written to w.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,95 @@
+package rofs_test
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/absfs/memfs"
+	"github.com/absfs/rofs"
+)
+
+var _ expvar.Var = (*rofs.Metrics)(nil)
+
+func TestMetrics(t *testing.T) {
+	mfs, err := memfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustMkdirAll(t, mfs, "/assets")
+	mustWrite(t, mfs, "/assets/app.js", "0123456789")
+
+	m := rofs.NewMetrics()
+	assets, err := rofs.NewFS(mfs, rofs.WithObserver(m.Observer("assets")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rofs.NewFS(mfs, rofs.WithObserver(m.Observer(`we"ird`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := assets.Open("/assets/app.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	f.Read(buf)
+	f.ReadAt(buf, 8)
+	held, err := assets.Open("/assets/app.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Close()
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	assets.Stat("/assets")
+	assets.Lstat("/assets/app.js")
+	assets.ReadDir("/assets")
+	assets.OpenFile("/assets/app.js", os.O_WRONLY, 0)
+	assets.Remove("/assets/app.js")
+	assets.Remove("/assets/app.js")
+	other.Mkdir("/x", 0755)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE rofs_opens_total counter\n",
+		`rofs_opens_total{mount="assets"} 3` + "\n",
+		`rofs_stats_total{mount="assets"} 2` + "\n",
+		`rofs_readdirs_total{mount="assets"} 1` + "\n",
+		`rofs_read_bytes_total{mount="assets"} 6` + "\n",
+		`rofs_open_handles{mount="assets"} 1` + "\n",
+		`rofs_denied_total{mount="assets",op="open"} 1` + "\n",
+		`rofs_denied_total{mount="assets",op="remove"} 2` + "\n",
+		`rofs_denied_total{mount="we\"ird",op="mkdir"} 1` + "\n",
+		"# TYPE rofs_operation_duration_seconds histogram\n",
+		`rofs_operation_duration_seconds_bucket{mount="assets",op="read",le="+Inf"} 2` + "\n",
+		`rofs_operation_duration_seconds_count{mount="assets",op="stat"} 1` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %q:\n%s", want, body)
+		}
+	}
+
+	var vars map[string]struct {
+		Opens       uint64            `json:"opens"`
+		ReadBytes   int64             `json:"read_bytes"`
+		OpenHandles int64             `json:"open_handles"`
+		Denied      map[string]uint64 `json:"denied"`
+	}
+	if err := json.Unmarshal([]byte(m.String()), &vars); err != nil {
+		t.Fatal(err)
+	}
+	if a := vars["assets"]; a.Opens != 3 || a.ReadBytes != 6 || a.OpenHandles != 1 || a.Denied["remove"] != 2 {
+		t.Errorf("expvar assets: %+v", a)
+	}
+}
@@ -0,0 +1,286 @@
+package rofs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// An Observer is told about every operation made through the views it is
+// given to with WithObserver, and through the files they open. Before is
+// called when the operation starts and After, with the same Event, when it
+// has completed. Observers may be called concurrently, but never
+// concurrently for the same Event.
+type Observer interface {
+	Before(e *Event)
+	After(e *Event)
+}
+
+// An Event describes an operation seen by an Observer.
+type Event struct {
+	// Op names the operation after the method, in lower case: "open" for
+	// OpenFile, Open and Create, "mkdirall" for MkdirAll and so on. Read
+	// and ReadAt are both "read", Write, WriteAt and WriteString are all
+	// "write", and Readdir, Readdirnames and ReadDir are all "readdir".
+	Op string
+
+	// Path is the absolute path the operation is made on, as seen through
+	// the view. Target is the new path of a rename, or the target of a
+	// symbolic link.
+	Path   string
+	Target string
+
+	// File is set for operations on an open File.
+	File bool
+
+	// Flags holds the OpenFile flags of an open.
+	Flags int
+
+	// Context is the context of the view, as set with
+	// FileSystem.WithContext.
+	Context context.Context
+
+	// Start is the time Before was called.
+	Start time.Time
+
+	// Bytes, Duration and Err are set before After is called. Bytes is the
+	// number of bytes read or written, Duration the time the operation took
+	// and Err the error it returned.
+	Bytes    int64
+	Duration time.Duration
+	Err      error
+
+	// State is left for the Observer to pass a value, such as a trace span,
+	// from Before to After.
+	State any
+}
+
+// WithObserver reports every operation made through the view to obs. Views
+// without an observer skip the reporting entirely.
+func WithObserver(obs Observer) Option {
+	return func(o *options) {
+		o.observer = obs
+	}
+}
+
+// Observers returns an Observer reporting each event to every one of obs in
+// turn. Each of them gets its own Event.State.
+func Observers(obs ...Observer) Observer {
+	return multiObserver(append([]Observer(nil), obs...))
+}
+
+type multiObserver []Observer
+
+func (m multiObserver) Before(e *Event) {
+	states := make([]any, len(m))
+	for i, o := range m {
+		e.State = nil
+		o.Before(e)
+		states[i] = e.State
+	}
+	e.State = states
+}
+
+func (m multiObserver) After(e *Event) {
+	states := e.State.([]any)
+	for i, o := range m {
+		e.State = states[i]
+		o.After(e)
+	}
+	e.State = states
+}
+
+// observe reports the start of op on name to the observer of the view. The
+// caller must pass the returned event to observed once op has completed.
+func (f *FileSystem) observe(op, name, target string, flag int) *Event {
+	e := &Event{Op: op, Path: f.abs(name), Target: target, Flags: flag, Context: f.Context(), Start: time.Now()}
+	f.opts.observer.Before(e)
+	return e
+}
+
+// observed reports the end of the operation of e, which transferred n bytes
+// and failed with err.
+func (f *FileSystem) observed(e *Event, n int, err error) {
+	e.Bytes, e.Duration, e.Err = int64(n), time.Since(e.Start), err
+	f.opts.observer.After(e)
+}
+
+// observe is FileSystem.observe for an operation on the file.
+func (f *File) observe(op string) *Event {
+	e := &Event{Op: op, Path: f.name, File: true, Context: f.fs.Context(), Start: time.Now()}
+	f.fs.opts.observer.Before(e)
+	return e
+}
+
+// failed reports whether err is an error other than io.EOF, which reads
+// return at the end of a file or directory.
+func failed(err error) bool {
+	return err != nil && err != io.EOF
+}
+
+type slogObserver struct {
+	logger *slog.Logger
+	level  slog.Level
+}
+
+// NewSlogObserver returns an Observer logging every completed operation to
+// logger at level, or at slog.LevelWarn if it failed with an error other
+// than io.EOF or one matching fs.ErrNotExist. A nil logger stands for
+// slog.Default().
+func NewSlogObserver(logger *slog.Logger, level slog.Level) Observer {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return slogObserver{logger, level}
+}
+
+func (s slogObserver) Before(*Event) {}
+
+func (s slogObserver) After(e *Event) {
+	level := s.level
+	if failed(e.Err) && !errors.Is(e.Err, fs.ErrNotExist) && level < slog.LevelWarn {
+		level = slog.LevelWarn
+	}
+	ctx := e.Context
+	if !s.logger.Enabled(ctx, level) {
+		return
+	}
+	attrs := []slog.Attr{slog.String("op", e.Op), slog.String("path", e.Path)}
+	if e.Target != "" {
+		attrs = append(attrs, slog.String("target", e.Target))
+	}
+	if e.Op == "open" {
+		attrs = append(attrs, slog.String("flags", flagString(e.Flags)))
+	}
+	if e.Bytes != 0 {
+		attrs = append(attrs, slog.Int64("bytes", e.Bytes))
+	}
+	attrs = append(attrs, slog.Duration("duration", e.Duration))
+	if e.Err != nil {
+		attrs = append(attrs, slog.Any("error", e.Err))
+	}
+	s.logger.LogAttrs(ctx, level, "rofs", attrs...)
+}
+
+// OpStats are the totals a Counters registry keeps for an operation. Errors
+// does not count reads that ended with io.EOF.
+type OpStats struct {
+	Calls  uint64
+	Errors uint64
+	Bytes  int64
+	Time   time.Duration
+}
+
+// Counters is an Observer keeping per-operation totals in memory. The zero
+// value is ready to use.
+type Counters struct {
+	mu  sync.Mutex
+	ops map[string]*OpStats
+}
+
+func (c *Counters) Before(*Event) {}
+
+func (c *Counters) After(e *Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ops == nil {
+		c.ops = make(map[string]*OpStats)
+	}
+	s := c.ops[e.Op]
+	if s == nil {
+		s = new(OpStats)
+		c.ops[e.Op] = s
+	}
+	s.Calls++
+	if failed(e.Err) {
+		s.Errors++
+	}
+	s.Bytes += e.Bytes
+	s.Time += e.Duration
+}
+
+// Get returns the totals of op.
+func (c *Counters) Get(op string) OpStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s := c.ops[op]; s != nil {
+		return *s
+	}
+	return OpStats{}
+}
+
+// Ops returns the operations seen so far, sorted.
+func (c *Counters) Ops() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ops := make([]string, 0, len(c.ops))
+	for op := range c.ops {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	return ops
+}
+
+// Reset clears all totals.
+func (c *Counters) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ops = nil
+}
+
+// A Tracer starts trace spans. Its method set is a subset of what tracing
+// libraries such as OpenTelemetry offer, so that one can be adapted with a
+// few lines of code.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// A Span is a trace span started by a Tracer.
+type Span interface {
+	SetAttribute(key string, value any)
+	RecordError(err error)
+	End()
+}
+
+type traceObserver struct {
+	tracer Tracer
+}
+
+// NewTraceObserver returns an Observer recording each operation as a span
+// named "rofs." followed by the operation, started from the context of the
+// view. The spans carry the attributes "path", "target", "flags" and
+// "bytes" where they apply.
+func NewTraceObserver(t Tracer) Observer {
+	return traceObserver{t}
+}
+
+func (t traceObserver) Before(e *Event) {
+	_, span := t.tracer.Start(e.Context, "rofs."+e.Op)
+	span.SetAttribute("path", e.Path)
+	if e.Target != "" {
+		span.SetAttribute("target", e.Target)
+	}
+	if e.Op == "open" {
+		span.SetAttribute("flags", flagString(e.Flags))
+	}
+	e.State = span
+}
+
+func (t traceObserver) After(e *Event) {
+	span, ok := e.State.(Span)
+	if !ok {
+		return
+	}
+	if e.Bytes != 0 {
+		span.SetAttribute("bytes", e.Bytes)
+	}
+	if failed(e.Err) {
+		span.RecordError(e.Err)
+	}
+	span.End()
+}
@@ -0,0 +1,239 @@
+package rofs_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/absfs/memfs"
+	"github.com/absfs/rofs"
+)
+
+// eventRecorder is an Observer keeping a copy of every completed event.
+type eventRecorder struct {
+	mu     sync.Mutex
+	before int
+	events []rofs.Event
+}
+
+func (r *eventRecorder) Before(e *rofs.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.before++
+	e.State = r.before
+}
+
+func (r *eventRecorder) After(e *rofs.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, *e)
+}
+
+func TestObserver(t *testing.T) {
+	for _, b := range testBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			dir := path.Join(b.dir, "observer")
+			mustMkdirAll(t, b.fs, path.Join(dir, "data"))
+			mustWrite(t, b.fs, path.Join(dir, "data", "file"), "0123456789")
+
+			rec := new(eventRecorder)
+			rfs, err := rofs.NewFS(b.fs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			view, err := rfs.SubFS(dir, rofs.WithObserver(rec))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := view.Chdir("/data"); err != nil {
+				t.Fatal(err)
+			}
+			f, err := view.OpenFile("file", os.O_RDONLY, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf := make([]byte, 4)
+			if _, err := f.Read(buf); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.ReadAt(buf, 8); err != io.EOF {
+				t.Fatalf("ReadAt at the end: %v", err)
+			}
+			if _, err := f.Write(buf); err == nil {
+				t.Fatal("Write succeeded")
+			}
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err := view.Rename("file", "/moved"); err == nil {
+				t.Fatal("Rename succeeded")
+			}
+			if _, err := view.ReadFile("/data/file"); err != nil {
+				t.Fatal(err)
+			}
+
+			type summary struct {
+				Op, Path, Target string
+				File             bool
+				Bytes            int64
+				Failed           bool
+			}
+			want := []summary{
+				{"chdir", "/data", "", false, 0, false},
+				{"open", "/data/file", "", false, 0, false},
+				{"read", "/data/file", "", true, 4, false},
+				{"read", "/data/file", "", true, 2, true},
+				{"write", "/data/file", "", true, 0, true},
+				{"close", "/data/file", "", true, 0, false},
+				{"rename", "/data/file", "/moved", false, 0, true},
+				{"readfile", "/data/file", "", false, 10, false},
+			}
+			var got []summary
+			for i, e := range rec.events {
+				got = append(got, summary{e.Op, e.Path, e.Target, e.File, e.Bytes, e.Err != nil})
+				if e.State != i+1 {
+					t.Errorf("%s: State %v, want %d", e.Op, e.State, i+1)
+				}
+				if e.Start.IsZero() || e.Duration < 0 {
+					t.Errorf("%s: Start %v, Duration %v", e.Op, e.Start, e.Duration)
+				}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("events:\ngot  %v\nwant %v", got, want)
+			}
+			if !errors.Is(rec.events[4].Err, rofs.ErrReadOnly) {
+				t.Errorf("write: Err = %v, want ErrReadOnly", rec.events[4].Err)
+			}
+		})
+	}
+}
+
+func TestObserverNoAllocs(t *testing.T) {
+	mfs, err := memfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, mfs, "/file", "0123456789")
+	rfs, err := rofs.NewFS(mfs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := rfs.Open("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	buf := make([]byte, 4)
+	if n := testing.AllocsPerRun(100, func() { f.ReadAt(buf, 2) }); n != 0 {
+		t.Errorf("ReadAt without an observer allocates %v times", n)
+	}
+}
+
+func TestCounters(t *testing.T) {
+	mfs, err := memfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, mfs, "/file", "0123456789")
+	var c rofs.Counters
+	rfs, err := rofs.NewFS(mfs, rofs.WithObserver(&c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := rfs.ReadFile("/file"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := rfs.Stat("/missing"); err == nil {
+		t.Fatal("Stat of a missing file succeeded")
+	}
+	if got := c.Get("readfile"); got.Calls != 3 || got.Errors != 0 || got.Bytes != 30 {
+		t.Errorf("readfile: %+v", got)
+	}
+	if got := c.Get("stat"); got.Calls != 1 || got.Errors != 1 {
+		t.Errorf("stat: %+v", got)
+	}
+	if got := c.Ops(); !reflect.DeepEqual(got, []string{"readfile", "stat"}) {
+		t.Errorf("Ops() = %v", got)
+	}
+	c.Reset()
+	if got := c.Ops(); len(got) != 0 {
+		t.Errorf("Ops() after Reset = %v", got)
+	}
+}
+
+type ctxKey struct{}
+
+// testTracer records the spans it starts.
+type testTracer struct {
+	spans []*testSpan
+}
+
+type testSpan struct {
+	name   string
+	parent any
+	attrs  map[string]any
+	err    error
+	ended  bool
+}
+
+func (t *testTracer) Start(ctx context.Context, name string) (context.Context, rofs.Span) {
+	s := &testSpan{name: name, parent: ctx.Value(ctxKey{}), attrs: make(map[string]any)}
+	t.spans = append(t.spans, s)
+	return context.WithValue(ctx, ctxKey{}, s), s
+}
+
+func (s *testSpan) SetAttribute(key string, value any) { s.attrs[key] = value }
+func (s *testSpan) RecordError(err error)              { s.err = err }
+func (s *testSpan) End()                               { s.ended = true }
+
+func TestTraceAndSlogObservers(t *testing.T) {
+	mfs, err := memfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, mfs, "/file", "0123456789")
+	tracer := new(testTracer)
+	var buf bytes.Buffer
+	rfs, err := rofs.NewFS(mfs, rofs.WithObserver(rofs.Observers(
+		rofs.NewTraceObserver(tracer),
+		rofs.NewSlogObserver(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})), slog.LevelDebug),
+	)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	view := rfs.WithContext(context.WithValue(context.Background(), ctxKey{}, "request"))
+	if _, err := view.ReadFile("/file"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := view.OpenFile("/file", os.O_WRONLY|os.O_APPEND, 0); err == nil {
+		t.Fatal("OpenFile succeeded")
+	}
+
+	if len(tracer.spans) != 2 {
+		t.Fatalf("%d spans, want 2", len(tracer.spans))
+	}
+	read, open := tracer.spans[0], tracer.spans[1]
+	if read.name != "rofs.readfile" || read.parent != "request" || read.attrs["bytes"] != int64(10) || read.err != nil || !read.ended {
+		t.Errorf("readfile span: %+v", read)
+	}
+	if open.name != "rofs.open" || open.attrs["flags"] != "O_WRONLY|O_APPEND" || !errors.Is(open.err, rofs.ErrReadOnly) || !open.ended {
+		t.Errorf("open span: %+v", open)
+	}
+
+	out := buf.String()
+	for _, want := range []string{"level=DEBUG msg=rofs op=readfile path=/file bytes=10", "level=WARN msg=rofs op=open path=/file flags=O_WRONLY|O_APPEND"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log output lacks %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package rofs
+
+import (
+	"path"
+	"time"
+
+	"github.com/absfs/absfs"
+)
+
+// An Option configures a FileSystem created by NewFS.
+type Option func(*options)
+
+// options holds the settings shared by a FileSystem and every view derived
+// from it with SubFS.
+type options struct {
+	symlinks  SymlinkPolicy
+	maxHops   int
+	maskWrite bool
+
+	// caps holds the operations let through by WithCapabilities.
+	caps Capability
+
+	// audit is the sink set by WithAudit.
+	audit AuditSink
+
+	// debug is the Debug set by WithDebug.
+	debug *Debug
+
+	// observer is the Observer set by WithObserver.
+	observer Observer
+
+	// rules holds the compiled rule sets of the view and its ancestors;
+	// pending collects the rules given by WithRules until they are anchored
+	// by apply.
+	rules   []ruleSet
+	pending []Rule
+
+	// writable holds the paths on the wrapped filesystem of the writable
+	// subtrees; pendingWritable collects the directories given by
+	// WithWritable until they are anchored by apply.
+	writable        []string
+	pendingWritable []string
+
+	// appendOnly and pendingAppendOnly do the same for WithAppendOnly.
+	appendOnly        []string
+	pendingAppendOnly []string
+
+	// retention is the period set by WithRetention and records the suffix
+	// set by WithRetentionRecords.
+	retention time.Duration
+	records   string
+
+	// seal is the index set by WithSealOnClose, shared with derived views;
+	// pendingSeal holds its name until it is anchored by apply.
+	seal        *sealIndex
+	pendingSeal string
+
+	now func() time.Time
+
+	// scratch is the upper layer set by WithScratch.
+	scratch absfs.SymlinkFileSystem
+}
+
+func defaultOptions() options {
+	return options{
+		symlinks: SymlinkFollow,
+		maxHops:  DefaultMaxSymlinkHops,
+		now:      time.Now,
+	}
+}
+
+// apply applies opts on top of o. Rules given in opts are anchored at root,
+// the path on the wrapped filesystem of the view being configured.
+func (o *options) apply(root string, opts []Option) error {
+	o.rules = append([]ruleSet(nil), o.rules...)
+	o.writable = append([]string(nil), o.writable...)
+	o.appendOnly = append([]string(nil), o.appendOnly...)
+	o.pending, o.pendingWritable, o.pendingAppendOnly = nil, nil, nil
+	for _, opt := range opts {
+		opt(o)
+	}
+	o.writable = anchor(o.writable, root, o.pendingWritable)
+	o.appendOnly = anchor(o.appendOnly, root, o.pendingAppendOnly)
+	o.pendingWritable, o.pendingAppendOnly = nil, nil
+	if o.pendingSeal != "" {
+		o.seal = &sealIndex{name: path.Join(root, path.Clean("/"+o.pendingSeal))}
+		o.pendingSeal = ""
+	}
+	if len(o.pending) > 0 {
+		set, err := compileRules(root, o.pending)
+		if err != nil {
+			return err
+		}
+		o.rules = append(o.rules, set)
+		o.pending = nil
+	}
+	return nil
+}
+
+// WithSymlinkPolicy sets how the FileSystem treats symbolic links. The
+// default is SymlinkFollow.
+func WithSymlinkPolicy(p SymlinkPolicy) Option {
+	return func(o *options) {
+		o.symlinks = p
+	}
+}
+
+// WithMaxSymlinkHops sets the number of symbolic links rofs will expand while
+// resolving a single path before giving up with syscall.ELOOP. It only applies
+// when rofs resolves links itself, that is under SymlinkConfine and
+// SymlinkNever. Values below one are ignored.
+func WithMaxSymlinkHops(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.maxHops = n
+		}
+	}
+}
+
+// WithMaskedWriteBits makes every FileInfo and fs.DirEntry returned by the
+// FileSystem and its files report a mode with all write permission bits
+// cleared, so that tools inspecting permissions see that the view cannot be
+// written. Sys still returns the backend's value, and DirEntry.Info is only
+// masked when it is called.
+func WithMaskedWriteBits() Option {
+	return func(o *options) {
+		o.maskWrite = true
+	}
+}
+
+// anchor appends dirs, taken relative to root, to list.
+func anchor(list []string, root string, dirs []string) []string {
+	for _, dir := range dirs {
+		list = append(list, path.Join(root, path.Clean("/"+dir)))
+	}
+	return list
+}
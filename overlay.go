@@ -0,0 +1,906 @@
+package rofs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/memfs"
+)
+
+// overlay is a filesystem that reads from a lower filesystem it never
+// modifies and keeps every change in an upper layer. A file that is modified
+// is first copied up into the upper layer, directory listings merge both
+// layers, and removed paths of the lower layer are recorded as whiteouts. It
+// is the backend of views created with WithScratch and NewDryRun.
+//
+// All paths handed to the layers are absolute, and overlay resolves symbolic
+// links itself so that links are followed across layers.
+type overlay struct {
+	lower absfs.SymlinkFileSystem
+
+	mu    sync.RWMutex
+	upper absfs.SymlinkFileSystem
+	cwd   string
+
+	// deleted holds the paths of the lower layer that have been removed;
+	// opaque the directories of the upper layer that hide the content of
+	// the lower directory at the same path.
+	deleted map[string]bool
+	opaque  map[string]bool
+
+	// log, if set, is called with every change while mu is held, together
+	// with the data of writes. It is called before the change is applied to
+	// the upper layer, which is left alone if log returns an error; the
+	// error is returned by the operation.
+	log func(a Action, data []byte) error
+
+	// diverged is the error of a change that failed in the upper layer after
+	// it had been logged. The log then holds a change the upper layer does
+	// not, and every later change fails with the error.
+	diverged error
+}
+
+// newOverlay returns an overlay of upper over lower. If upper is nil, a new
+// memfs is used. Otherwise upper must be empty, since the overlay owns it and
+// reset removes everything it holds.
+func newOverlay(lower, upper absfs.SymlinkFileSystem) (*overlay, error) {
+	if upper == nil {
+		mem, err := memfs.NewFS()
+		if err != nil {
+			return nil, err
+		}
+		upper = mem
+	} else {
+		entries, err := upper.ReadDir("/")
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) > 0 {
+			return nil, &fs.PathError{Op: "scratch", Path: "/", Err: syscall.ENOTEMPTY}
+		}
+	}
+	o := &overlay{
+		lower:   lower,
+		upper:   upper,
+		cwd:     "/",
+		deleted: make(map[string]bool),
+		opaque:  make(map[string]bool),
+	}
+	if cwd, err := lower.Getwd(); err == nil && cwd != "" {
+		o.cwd = path.Clean(cwd)
+	}
+	return o, nil
+}
+
+// reset drops every change by emptying the upper layer and forgetting the
+// whiteouts.
+func (o *overlay) reset() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	entries, err := o.upper.ReadDir("/")
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := o.upper.RemoveAll(path.Join("/", e.Name())); err != nil {
+			return err
+		}
+	}
+	o.deleted = make(map[string]bool)
+	o.opaque = make(map[string]bool)
+	return nil
+}
+
+// record logs a, a change about to be applied to the upper layer.
+func (o *overlay) record(a Action, data []byte) error {
+	if o.diverged != nil {
+		return &fs.PathError{Op: a.Op, Path: a.Path, Err: o.diverged}
+	}
+	if o.log != nil {
+		return o.log(a, data)
+	}
+	return nil
+}
+
+// diverge returns err, the error of applying a recorded change to the upper
+// layer, after remembering it for record.
+func (o *overlay) diverge(err error) error {
+	if err != nil && o.log != nil && o.diverged == nil {
+		o.diverged = underlying(err)
+	}
+	return err
+}
+
+func (o *overlay) abs(name string) string {
+	if path.IsAbs(name) {
+		return path.Clean(name)
+	}
+	return path.Join(o.cwd, name)
+}
+
+// lowerVisible reports whether the lower layer shows through at p.
+func (o *overlay) lowerVisible(p string) bool {
+	if o.deleted[p] {
+		return false
+	}
+	for dir := p; dir != "/"; {
+		dir = path.Dir(dir)
+		if o.deleted[dir] || o.opaque[dir] {
+			return false
+		}
+	}
+	return true
+}
+
+// find returns the layer providing p, which must not need symbolic links to
+// be resolved, together with its FileInfo.
+func (o *overlay) find(p string) (os.FileInfo, absfs.SymlinkFileSystem, error) {
+	if p == "/" {
+		// the root always exists in the upper layer; report the real one
+		info, err := o.lower.Lstat(p)
+		return info, o.lower, err
+	}
+	if info, err := o.upper.Lstat(p); err == nil {
+		return info, o.upper, nil
+	}
+	if o.lowerVisible(p) {
+		if info, err := o.lower.Lstat(p); err == nil {
+			return info, o.lower, nil
+		}
+	}
+	return nil, nil, fs.ErrNotExist
+}
+
+// inLower reports whether the lower layer has p and it is visible.
+func (o *overlay) inLower(p string) bool {
+	if !o.lowerVisible(p) {
+		return false
+	}
+	_, err := o.lower.Lstat(p)
+	return err == nil
+}
+
+// resolve expands the symbolic links in name across both layers. The last
+// element is only expanded if followLast is set. Elements that do not exist
+// are left as they are, so that the caller reports the error.
+func (o *overlay) resolve(op, name string, followLast bool) (string, error) {
+	rest := strings.TrimPrefix(o.abs(name), "/")
+	cur := "/"
+	hops := 0
+	for rest != "" {
+		var elem string
+		elem, rest, _ = strings.Cut(rest, "/")
+		next := path.Join(cur, elem)
+		if rest == "" && !followLast {
+			return next, nil
+		}
+		info, layer, err := o.find(next)
+		if err != nil || info.Mode()&fs.ModeSymlink == 0 {
+			cur = next
+			continue
+		}
+		if hops++; hops > DefaultMaxSymlinkHops {
+			return "", &fs.PathError{Op: op, Path: name, Err: syscall.ELOOP}
+		}
+		target, err := layer.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if !path.IsAbs(target) {
+			target = path.Join(cur, target)
+		}
+		rest = strings.TrimPrefix(path.Join(target, rest), "/")
+		cur = "/"
+	}
+	return cur, nil
+}
+
+// locate resolves name and returns the layer providing it.
+func (o *overlay) locate(op, name string, followLast bool) (string, os.FileInfo, absfs.SymlinkFileSystem, error) {
+	p, err := o.resolve(op, name, followLast)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	info, layer, err := o.find(p)
+	if err != nil {
+		return "", nil, nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return p, info, layer, nil
+}
+
+// readDir returns the merged, sorted entries of the directory at p.
+func (o *overlay) readDir(p string) ([]fs.DirEntry, error) {
+	seen := make(map[string]fs.DirEntry)
+	if info, err := o.upper.Lstat(p); err == nil && info.IsDir() {
+		list, err := o.upper.ReadDir(p)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range list {
+			seen[e.Name()] = e
+		}
+	}
+	if o.lowerVisible(p) && !o.opaque[p] {
+		if info, err := o.lower.Lstat(p); err == nil && info.IsDir() {
+			list, err := o.lower.ReadDir(p)
+			if err != nil {
+				return nil, err
+			}
+			for _, e := range list {
+				if _, ok := seen[e.Name()]; !ok && !o.deleted[path.Join(p, e.Name())] {
+					seen[e.Name()] = e
+				}
+			}
+		}
+	}
+	entries := make([]fs.DirEntry, 0, len(seen))
+	for _, e := range seen {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// ensureParent makes sure the parent directory of p exists in the upper
+// layer, copying it up if necessary.
+func (o *overlay) ensureParent(op, name, p string) error {
+	dir := path.Dir(p)
+	if dir == "/" {
+		return nil
+	}
+	info, layer, err := o.find(dir)
+	if err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	if !info.IsDir() {
+		return &fs.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+	}
+	if layer == o.upper {
+		return nil
+	}
+	if err := o.ensureParent(op, name, dir); err != nil {
+		return err
+	}
+	return o.mkdirCopy(dir, info)
+}
+
+// mkdirCopy creates the directory p in the upper layer with the permissions
+// of info, regardless of any umask the upper layer applies.
+func (o *overlay) mkdirCopy(p string, info os.FileInfo) error {
+	if err := o.upper.Mkdir(p, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return o.upper.Chmod(p, fs.ModeDir|info.Mode().Perm())
+}
+
+// copyUp copies p from the lower layer into the upper layer unless it is
+// there already. Directories are copied without their content.
+func (o *overlay) copyUp(op, name, p string) error {
+	info, layer, err := o.find(p)
+	if err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	if layer == o.upper || p == "/" {
+		return nil
+	}
+	if err := o.ensureParent(op, name, p); err != nil {
+		return err
+	}
+	switch {
+	case info.IsDir():
+		err = o.mkdirCopy(p, info)
+	case info.Mode()&fs.ModeSymlink != 0:
+		var target string
+		if target, err = o.lower.Readlink(p); err == nil {
+			err = o.upper.Symlink(target, p)
+		}
+	default:
+		err = copyFile(o.upper, o.lower, p, info)
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSymlink == 0 {
+		o.upper.Chtimes(p, info.ModTime(), info.ModTime())
+	}
+	return nil
+}
+
+// copyTree is copyUp for p and everything below it.
+func (o *overlay) copyTree(op, name, p string) error {
+	if err := o.copyUp(op, name, p); err != nil {
+		return err
+	}
+	info, err := o.upper.Lstat(p)
+	if err != nil || !info.IsDir() {
+		return err
+	}
+	entries, err := o.readDir(p)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := o.copyTree(op, name, path.Join(p, e.Name())); err != nil {
+			return err
+		}
+	}
+	o.opaque[p] = true
+	return nil
+}
+
+func copyFile(dst, src absfs.FileSystem, p string, info os.FileInfo) error {
+	in, err := src.Open(p)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := dst.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// created updates the whiteouts after p has been created in the upper layer.
+func (o *overlay) created(p string, dir bool) {
+	if o.deleted[p] {
+		delete(o.deleted, p)
+		if dir {
+			o.opaque[p] = true
+		}
+	}
+}
+
+// removed updates the whiteouts after p has been removed from the upper
+// layer, given whether the lower layer had it.
+func (o *overlay) removed(p string, lower bool) {
+	for _, m := range []map[string]bool{o.deleted, o.opaque} {
+		for q := range m {
+			if q == p || strings.HasPrefix(q, p+"/") {
+				delete(m, q)
+			}
+		}
+	}
+	if lower {
+		o.deleted[p] = true
+	}
+}
+
+// FileSystem interface
+
+func (o *overlay) Open(name string) (absfs.File, error) {
+	return o.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (o *overlay) Create(name string) (absfs.File, error) {
+	return o.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (o *overlay) OpenFile(name string, flag int, perm os.FileMode) (absfs.File, error) {
+	if flag&absfs.O_ACCESS == os.O_RDONLY && flag&writeFlags == 0 {
+		o.mu.RLock()
+		defer o.mu.RUnlock()
+		p, info, layer, err := o.locate("open", name, true)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			entries, err := o.readDir(p)
+			if err != nil {
+				return nil, err
+			}
+			file, err := layer.OpenFile(p, flag, perm)
+			if err != nil {
+				return nil, err
+			}
+			return &overlayDir{File: file, entries: entries}, nil
+		}
+		return layer.OpenFile(p, flag, perm)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, err := o.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	info, layer, err := o.find(p)
+	switch {
+	case err != nil && flag&absfs.O_CREATE == 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case err == nil && flag&(absfs.O_CREATE|absfs.O_EXCL) == absfs.O_CREATE|absfs.O_EXCL:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case err == nil && info.IsDir():
+		return nil, &fs.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	}
+
+	if err != nil {
+		if err := o.ensureParent("open", name, p); err != nil {
+			return nil, err
+		}
+		if err := o.record(Action{Op: "create", Path: p, Mode: perm.Perm()}, nil); err != nil {
+			return nil, err
+		}
+		file, err := o.upper.OpenFile(p, flag, perm)
+		if err != nil {
+			return nil, o.diverge(err)
+		}
+		o.created(p, false)
+		return &overlayFile{File: file, o: o, path: p, append: flag&absfs.O_APPEND != 0}, nil
+	}
+
+	if layer == o.lower {
+		if err := o.copyUp("open", name, p); err != nil {
+			return nil, err
+		}
+	}
+	truncate := flag&absfs.O_TRUNC != 0 && info.Size() > 0
+	if truncate {
+		if err := o.record(Action{Op: "truncate", Path: p}, nil); err != nil {
+			return nil, err
+		}
+	}
+	file, err := o.upper.OpenFile(p, flag&^(absfs.O_CREATE|absfs.O_EXCL), perm)
+	if err != nil {
+		if truncate {
+			return nil, o.diverge(err)
+		}
+		return nil, err
+	}
+	return &overlayFile{File: file, o: o, path: p, append: flag&absfs.O_APPEND != 0}, nil
+}
+
+func (o *overlay) Mkdir(name string, perm os.FileMode) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, err := o.resolve("mkdir", name, false)
+	if err != nil {
+		return err
+	}
+	return o.mkdir(name, p, perm)
+}
+
+func (o *overlay) mkdir(name, p string, perm os.FileMode) error {
+	if _, _, err := o.find(p); err == nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	if err := o.ensureParent("mkdir", name, p); err != nil {
+		return err
+	}
+	if err := o.record(Action{Op: "mkdir", Path: p, Mode: perm.Perm()}, nil); err != nil {
+		return err
+	}
+	if err := o.upper.Mkdir(p, perm); err != nil {
+		return o.diverge(err)
+	}
+	o.created(p, true)
+	return nil
+}
+
+func (o *overlay) MkdirAll(name string, perm os.FileMode) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, err := o.resolve("mkdir", name, true)
+	if err != nil {
+		return err
+	}
+	dir := "/"
+	for _, elem := range strings.Split(strings.TrimPrefix(p, "/"), "/") {
+		if elem == "" {
+			continue
+		}
+		dir = path.Join(dir, elem)
+		info, _, err := o.find(dir)
+		if err != nil {
+			if err := o.mkdir(name, dir, perm); err != nil {
+				return err
+			}
+			continue
+		}
+		if !info.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: name, Err: syscall.ENOTDIR}
+		}
+	}
+	return nil
+}
+
+func (o *overlay) Remove(name string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, info, layer, err := o.locate("remove", name, false)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		entries, err := o.readDir(p)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			return &fs.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
+	}
+	if err := o.record(Action{Op: "remove", Path: p}, nil); err != nil {
+		return err
+	}
+	if layer == o.upper {
+		if err := o.upper.Remove(p); err != nil {
+			return o.diverge(err)
+		}
+	}
+	o.removed(p, o.inLower(p))
+	return nil
+}
+
+func (o *overlay) RemoveAll(name string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, err := o.resolve("removeall", name, false)
+	if err != nil {
+		return err
+	}
+	_, layer, err := o.find(p)
+	if err != nil {
+		return nil
+	}
+	if err := o.record(Action{Op: "removeall", Path: p}, nil); err != nil {
+		return err
+	}
+	if layer == o.upper {
+		if err := o.upper.RemoveAll(p); err != nil {
+			return o.diverge(err)
+		}
+	}
+	o.removed(p, o.inLower(p))
+	return nil
+}
+
+func (o *overlay) Rename(oldpath, newpath string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	linkErr := func(err error) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: underlying(err)}
+	}
+	po, err := o.resolve("rename", oldpath, false)
+	if err != nil {
+		return linkErr(err)
+	}
+	pn, err := o.resolve("rename", newpath, false)
+	if err != nil {
+		return linkErr(err)
+	}
+	info, _, err := o.find(po)
+	if err != nil {
+		return linkErr(err)
+	}
+	if po == pn {
+		return nil
+	}
+	if strings.HasPrefix(pn, po+"/") {
+		return linkErr(syscall.EINVAL)
+	}
+	dst, dlayer, err := o.find(pn)
+	replace := err == nil
+	if replace {
+		switch {
+		case dst.IsDir() && !info.IsDir():
+			return linkErr(syscall.EISDIR)
+		case !dst.IsDir() && info.IsDir():
+			return linkErr(syscall.ENOTDIR)
+		case dst.IsDir():
+			entries, err := o.readDir(pn)
+			if err != nil {
+				return linkErr(err)
+			}
+			if len(entries) > 0 {
+				return linkErr(syscall.ENOTEMPTY)
+			}
+		}
+	}
+	// copying up does not change what the overlay shows
+	if err := o.copyTree("rename", oldpath, po); err != nil {
+		return linkErr(err)
+	}
+	if err := o.ensureParent("rename", newpath, pn); err != nil {
+		return linkErr(err)
+	}
+	if err := o.record(Action{Op: "rename", Path: po, Target: pn}, nil); err != nil {
+		return linkErr(err)
+	}
+	if replace {
+		if dlayer == o.upper {
+			if err := o.upper.RemoveAll(pn); err != nil {
+				return linkErr(o.diverge(err))
+			}
+		}
+		o.removed(pn, o.inLower(pn))
+	}
+	if err := o.upper.Rename(po, pn); err != nil {
+		return linkErr(o.diverge(err))
+	}
+	o.removed(po, o.inLower(po))
+	delete(o.deleted, pn)
+	if info.IsDir() {
+		o.opaque[pn] = true
+	}
+	return nil
+}
+
+// modify copies the file at name up and applies change to the copy.
+func (o *overlay) modify(op, name string, followLast bool, change func(p string) error, a Action) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, _, _, err := o.locate(op, name, followLast)
+	if err != nil {
+		return err
+	}
+	if err := o.copyUp(op, name, p); err != nil {
+		return err
+	}
+	a.Op, a.Path = op, p
+	if err := o.record(a, nil); err != nil {
+		return err
+	}
+	return o.diverge(change(p))
+}
+
+func (o *overlay) Chmod(name string, mode os.FileMode) error {
+	return o.modify("chmod", name, true, func(p string) error {
+		info, err := o.upper.Lstat(p)
+		if err != nil {
+			return err
+		}
+		// some filesystems, memfs among them, replace the file type as well
+		return o.upper.Chmod(p, mode&^fs.ModeType|info.Mode().Type())
+	}, Action{Mode: mode})
+}
+
+func (o *overlay) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return o.modify("chtimes", name, true, func(p string) error {
+		return o.upper.Chtimes(p, atime, mtime)
+	}, Action{Atime: &atime, Mtime: &mtime})
+}
+
+func (o *overlay) Chown(name string, uid, gid int) error {
+	return o.modify("chown", name, true, func(p string) error {
+		return o.upper.Chown(p, uid, gid)
+	}, Action{UID: &uid, GID: &gid})
+}
+
+func (o *overlay) Lchown(name string, uid, gid int) error {
+	return o.modify("lchown", name, false, func(p string) error {
+		return o.upper.Lchown(p, uid, gid)
+	}, Action{UID: &uid, GID: &gid})
+}
+
+func (o *overlay) Truncate(name string, size int64) error {
+	return o.modify("truncate", name, true, func(p string) error {
+		return o.upper.Truncate(p, size)
+	}, Action{Size: size})
+}
+
+func (o *overlay) Symlink(oldname, newname string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, err := o.resolve("symlink", newname, false)
+	if err != nil {
+		return err
+	}
+	if _, _, err := o.find(p); err == nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: fs.ErrExist}
+	}
+	if err := o.ensureParent("symlink", newname, p); err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: underlying(err)}
+	}
+	if err := o.record(Action{Op: "symlink", Path: p, Target: oldname}, nil); err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: underlying(err)}
+	}
+	if err := o.upper.Symlink(oldname, p); err != nil {
+		return o.diverge(err)
+	}
+	o.created(p, false)
+	return nil
+}
+
+func (o *overlay) Stat(name string) (os.FileInfo, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	_, info, _, err := o.locate("stat", name, true)
+	return info, err
+}
+
+func (o *overlay) Lstat(name string) (os.FileInfo, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	_, info, _, err := o.locate("lstat", name, false)
+	return info, err
+}
+
+func (o *overlay) Readlink(name string) (string, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	p, _, layer, err := o.locate("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	return layer.Readlink(p)
+}
+
+func (o *overlay) ReadDir(name string) ([]fs.DirEntry, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	p, info, _, err := o.locate("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: syscall.ENOTDIR}
+	}
+	return o.readDir(p)
+}
+
+func (o *overlay) ReadFile(name string) ([]byte, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	p, _, layer, err := o.locate("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return layer.ReadFile(p)
+}
+
+func (o *overlay) Chdir(dir string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, info, _, err := o.locate("chdir", dir, true)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return &fs.PathError{Op: "chdir", Path: dir, Err: syscall.ENOTDIR}
+	}
+	o.cwd = p
+	return nil
+}
+
+func (o *overlay) Getwd() (string, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.cwd, nil
+}
+
+func (o *overlay) TempDir() string {
+	return o.lower.TempDir()
+}
+
+func (o *overlay) Sub(dir string) (fs.FS, error) {
+	return absfs.FilerToFS(o, dir)
+}
+
+// overlayFile is a file of the upper layer opened for writing. It records
+// the changes made through it.
+type overlayFile struct {
+	absfs.File
+	o      *overlay
+	path   string
+	append bool // opened with O_APPEND
+}
+
+// write records the write of p at off and then makes it with write. An
+// offset of -1 stands for the offset Write would use.
+func (f *overlayFile) write(p []byte, off int64, write func() (int, error)) (int, error) {
+	f.o.mu.Lock()
+	defer f.o.mu.Unlock()
+	if len(p) == 0 {
+		return write()
+	}
+	if off < 0 {
+		var err error
+		if off, err = f.offset(); err != nil {
+			return 0, err
+		}
+	}
+	if err := f.o.record(Action{Op: "write", Path: f.path, Offset: off, Size: int64(len(p))}, p); err != nil {
+		return 0, err
+	}
+	n, err := write()
+	if n < len(p) {
+		// the log holds all of p
+		if err == nil {
+			err = io.ErrShortWrite
+		}
+		err = f.o.diverge(err)
+	}
+	return n, err
+}
+
+// offset returns the offset the next Write starts at.
+func (f *overlayFile) offset() (int64, error) {
+	if f.append {
+		info, err := f.File.Stat()
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	}
+	return f.File.Seek(0, io.SeekCurrent)
+}
+
+func (f *overlayFile) Write(p []byte) (int, error) {
+	return f.write(p, -1, func() (int, error) { return f.File.Write(p) })
+}
+
+func (f *overlayFile) WriteAt(p []byte, off int64) (int, error) {
+	return f.write(p, off, func() (int, error) { return f.File.WriteAt(p, off) })
+}
+
+func (f *overlayFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *overlayFile) Truncate(size int64) error {
+	f.o.mu.Lock()
+	defer f.o.mu.Unlock()
+	if err := f.o.record(Action{Op: "truncate", Path: f.path, Size: size}, nil); err != nil {
+		return err
+	}
+	return f.o.diverge(f.File.Truncate(size))
+}
+
+// overlayDir is a directory whose entries have been merged from both layers
+// when it was opened.
+type overlayDir struct {
+	absfs.File
+	entries []fs.DirEntry
+	pos     int
+}
+
+func (d *overlayDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.pos:]
+	if n <= 0 {
+		d.pos = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.pos += n
+	return rest[:n], nil
+}
+
+func (d *overlayDir) Readdir(n int) ([]os.FileInfo, error) {
+	entries, err := d.ReadDir(n)
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		info, ierr := e.Info()
+		if ierr != nil {
+			return infos, ierr
+		}
+		infos = append(infos, info)
+	}
+	return infos, err
+}
+
+func (d *overlayDir) Readdirnames(n int) ([]string, error) {
+	entries, err := d.ReadDir(n)
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+	return names, err
+}
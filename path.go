@@ -0,0 +1,55 @@
+package rofs
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// abs resolves name against the working directory of the view. The result is
+// a clean absolute path in the view's own namespace; because it is cleaned
+// lexically, ".." elements can never climb above the view's root.
+func (f *FileSystem) abs(name string) string {
+	if path.IsAbs(name) {
+		return path.Clean(name)
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return path.Join(f.cwd, name)
+}
+
+// real maps name to the path it has on the wrapped filesystem.
+func (f *FileSystem) real(name string) string {
+	return path.Join(f.root, f.abs(name))
+}
+
+// virtual maps a path on the wrapped filesystem back into the view's
+// namespace. Paths outside the root are returned unchanged.
+func (f *FileSystem) virtual(name string) string {
+	if f.root == "/" {
+		return name
+	}
+	switch {
+	case name == f.root:
+		return "/"
+	case strings.HasPrefix(name, f.root+"/"):
+		return name[len(f.root):]
+	}
+	return name
+}
+
+// translate rewrites the paths carried by errors from the wrapped filesystem
+// so they are relative to the view's root rather than the backend's.
+func (f *FileSystem) translate(err error) error {
+	if err == nil || f.root == "/" {
+		return err
+	}
+	switch e := err.(type) {
+	case *fs.PathError:
+		return &fs.PathError{Op: e.Op, Path: f.virtual(e.Path), Err: e.Err}
+	case *os.LinkError:
+		return &os.LinkError{Op: e.Op, Old: f.virtual(e.Old), New: f.virtual(e.New), Err: e.Err}
+	}
+	return err
+}
@@ -0,0 +1,184 @@
+package rofs
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/absfs/absfs"
+)
+
+// WithRetention makes files immutable once they are older than period. Until
+// then a file can be written, truncated, renamed and removed as usual where
+// the view allows it; afterwards every such operation fails with a
+// *RetentionError reporting when the file's writable window closed.
+// Directories are not locked themselves, but they cannot be removed or
+// renamed while they contain a locked file.
+//
+// The age of a file is taken from its modification time, so the window
+// starts again every time the file is modified. Chtimes may not move the
+// modification time of a file forward, which would extend the window
+// without writing to the file; it fails with ErrReadOnly. Use
+// WithRetentionRecords for a window that starts when the file is created and
+// cannot be extended.
+// The decision is made on every call, including every File.Write, against
+// the clock set with WithClock.
+func WithRetention(period time.Duration) Option {
+	return func(o *options) {
+		o.retention = period
+	}
+}
+
+// WithRetentionRecords makes WithRetention keep a sidecar retention record
+// for every file created through the view, named after the file with suffix
+// appended, such as "report.pdf.retention" for suffix ".retention". The
+// record holds the time the file's writable window closes and takes
+// precedence over the file's modification time. Records are moved and
+// removed along with their files and cannot be modified through the view.
+// Files without a record fall back to their modification time.
+func WithRetentionRecords(suffix string) Option {
+	return func(o *options) {
+		o.records = suffix
+	}
+}
+
+// WithClock sets the function the FileSystem uses to tell the time. The
+// default is time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		if now != nil {
+			o.now = now
+		}
+	}
+}
+
+// RetentionError is the error, wrapped in a *fs.PathError or *os.LinkError,
+// that reports an operation refused because the retention period of a file
+// has expired and the file is now immutable. errors.Is reports true when it
+// is compared with ErrReadOnly, fs.ErrPermission or syscall.EROFS.
+type RetentionError struct {
+	// Expiry is the time the file's writable window closed.
+	Expiry time.Time
+}
+
+func (e *RetentionError) Error() string {
+	return "file immutable since " + e.Expiry.Format(time.RFC3339)
+}
+
+func (e *RetentionError) Is(target error) bool {
+	return target == ErrReadOnly || target == fs.ErrPermission || target == syscall.EROFS
+}
+
+// retainCreate reports whether the mutating operation op creates a new name
+// rather than modifying an existing one. Opening is checked by OpenFile,
+// which knows whether the file exists.
+func retainCreate(op string) bool {
+	return op == "open" || op == "mkdir" || op == "symlink"
+}
+
+// retained returns the error to report if the retention policy forbids op
+// on the file at real, or nil.
+func (f *FileSystem) retained(op, name, real string) error {
+	if f.opts.retention <= 0 {
+		return nil
+	}
+	if f.opts.records != "" && strings.HasSuffix(real, f.opts.records) {
+		return readOnly(op, name)
+	}
+	if retainCreate(op) {
+		return nil
+	}
+	return f.locked(op, name, real, op == "rename" || op == "removeall")
+}
+
+// locked returns a *RetentionError wrapped in a *fs.PathError if the file at
+// real has been locked by the retention policy. With deep set, files below a
+// directory at real are checked as well.
+func (f *FileSystem) locked(op, name, real string, deep bool) error {
+	info, err := f.fs.Lstat(real)
+	if err != nil {
+		// let the wrapped filesystem report the problem
+		return nil
+	}
+	if !info.IsDir() {
+		expiry := f.expiry(real, info)
+		if f.opts.now().Before(expiry) {
+			return nil
+		}
+		return &fs.PathError{Op: op, Path: name, Err: &RetentionError{Expiry: expiry}}
+	}
+	if !deep {
+		return nil
+	}
+	entries, err := f.fs.ReadDir(real)
+	if err != nil {
+		return nil
+	}
+	for _, e := range entries {
+		if err := f.locked(op, name, path.Join(real, e.Name()), true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extendsRetention reports whether setting the modification time of the file
+// at real to mtime would move it forward and so extend its writable window.
+func (f *FileSystem) extendsRetention(real string, mtime time.Time) bool {
+	if f.opts.retention <= 0 {
+		return false
+	}
+	info, err := f.fs.Stat(real)
+	return err == nil && !info.IsDir() && mtime.After(info.ModTime())
+}
+
+// expiry returns the time the writable window of the file at real closes.
+func (f *FileSystem) expiry(real string, info os.FileInfo) time.Time {
+	if f.opts.records != "" {
+		if data, err := f.fs.ReadFile(real + f.opts.records); err == nil {
+			if t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(data))); err == nil {
+				return t
+			}
+		}
+	}
+	return info.ModTime().Add(f.opts.retention)
+}
+
+// recordCreated writes the retention record of the file at real, which has
+// just been created through the view.
+func (f *FileSystem) recordCreated(real string) error {
+	if f.opts.retention <= 0 || f.opts.records == "" {
+		return nil
+	}
+	rec, err := f.fs.OpenFile(real+f.opts.records, absfs.O_WRONLY|absfs.O_CREATE|absfs.O_TRUNC, 0444)
+	if err != nil {
+		return err
+	}
+	_, err = rec.WriteString(f.opts.now().Add(f.opts.retention).Format(time.RFC3339Nano) + "\n")
+	if cerr := rec.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// moveRecord moves the retention record of a file renamed from oldreal to
+// newreal, if there is one.
+func (f *FileSystem) moveRecord(oldreal, newreal string) {
+	if f.opts.retention <= 0 || f.opts.records == "" {
+		return
+	}
+	f.fs.Remove(newreal + f.opts.records)
+	f.fs.Rename(oldreal+f.opts.records, newreal+f.opts.records)
+}
+
+// removeRecord removes the retention record of the removed file at real, if
+// there is one.
+func (f *FileSystem) removeRecord(real string) {
+	if f.opts.retention <= 0 || f.opts.records == "" {
+		return
+	}
+	f.fs.Remove(real + f.opts.records)
+}
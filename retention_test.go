@@ -0,0 +1,213 @@
+package rofs_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/absfs/ioutil"
+	"github.com/absfs/memfs"
+	"github.com/absfs/rofs"
+)
+
+// fakeClock is a clock tests can move forward.
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func TestRetention(t *testing.T) {
+	for _, b := range testBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			dir := path.Join(b.dir, "retention")
+			mustMkdirAll(t, b.fs, path.Join(dir, "archive", "2023"))
+			mustWrite(t, b.fs, path.Join(dir, "archive", "2023", "old.txt"), "old")
+			mtime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			if err := b.fs.Chtimes(path.Join(dir, "archive", "2023", "old.txt"), mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+
+			clock := &fakeClock{now: mtime.Add(time.Hour)}
+			rfs, err := rofs.NewFS(b.fs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			view, err := rfs.SubFS(dir,
+				rofs.WithWritable("/"),
+				rofs.WithRetention(24*time.Hour),
+				rofs.WithClock(clock.Now))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expired := func(t *testing.T, what string, err error, want time.Time) {
+				t.Helper()
+				var re *rofs.RetentionError
+				if !errors.As(err, &re) {
+					t.Fatalf("%s: got %v, want *RetentionError", what, err)
+				}
+				if !re.Expiry.Equal(want) {
+					t.Errorf("%s: expiry %v, want %v", what, re.Expiry, want)
+				}
+				if !errors.Is(err, rofs.ErrReadOnly) || !errors.Is(err, fs.ErrPermission) || !errors.Is(err, syscall.EROFS) {
+					t.Errorf("%s: %v does not match ErrReadOnly, ErrPermission and EROFS", what, err)
+				}
+				if !strings.Contains(err.Error(), want.Format(time.RFC3339)) {
+					t.Errorf("%s: message %q does not report the expiry", what, err)
+				}
+			}
+
+			// within the window everything is allowed
+			if err := view.Chmod("/archive/2023/old.txt", 0644); err != nil {
+				t.Fatal(err)
+			}
+			mtime = mtime.Add(-time.Minute)
+			if err := view.Chtimes("/archive/2023/old.txt", mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+
+			// except moving the modification time forward, which would
+			// extend the window
+			future := clock.now.Add(365 * 24 * time.Hour)
+			if err := view.Chtimes("/archive/2023/old.txt", future, future); !errors.Is(err, rofs.ErrReadOnly) {
+				t.Fatalf("Chtimes forward: got %v, want ErrReadOnly", err)
+			}
+			expiry := mtime.Add(24 * time.Hour)
+
+			f, err := view.OpenFile("/archive/2023/old.txt", os.O_WRONLY|os.O_APPEND, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			clock.Advance(24 * time.Hour)
+
+			_, err = f.WriteString("more")
+			expired(t, "Write on open file", err, expiry)
+			expired(t, "File.Truncate", f.Truncate(0), expiry)
+			_, err = view.OpenFile("/archive/2023/old.txt", os.O_RDWR, 0)
+			expired(t, "OpenFile", err, expiry)
+			expired(t, "Remove", view.Remove("/archive/2023/old.txt"), expiry)
+			expired(t, "Truncate", view.Truncate("/archive/2023/old.txt", 0), expiry)
+			expired(t, "Chtimes", view.Chtimes("/archive/2023/old.txt", clock.now, clock.now), expiry)
+			expired(t, "Rename", view.Rename("/archive/2023/old.txt", "/archive/new.txt"), expiry)
+			expired(t, "Rename over", view.Rename("/archive/2023", "/archive/2024"), expiry)
+			expired(t, "RemoveAll", view.RemoveAll("/archive"), expiry)
+
+			var le *os.LinkError
+			if err := view.Rename("/archive/2023/old.txt", "/x"); !errors.As(err, &le) {
+				t.Errorf("Rename error: got %T", err)
+			}
+
+			// reads and new files are unaffected
+			if data, err := view.ReadFile("/archive/2023/old.txt"); err != nil || string(data) != "old" {
+				t.Errorf("ReadFile: got %q, %v", data, err)
+			}
+			if err := view.Mkdir("/archive/2025", 0755); err != nil {
+				t.Error(err)
+			}
+			if err := ioutil.WriteFile(view, "/archive/2025/new.txt", []byte("new"), 0644); err != nil {
+				t.Error(err)
+			}
+			if err := view.Remove("/archive/2025/new.txt"); err != nil {
+				t.Errorf("Remove within window: %v", err)
+			}
+		})
+	}
+}
+
+func TestRetentionRecords(t *testing.T) {
+	for _, b := range testBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			dir := path.Join(b.dir, "records")
+			mustMkdirAll(t, b.fs, dir)
+
+			clock := &fakeClock{now: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+			rfs, err := rofs.NewFS(b.fs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			view, err := rfs.SubFS(dir,
+				rofs.WithWritable("/"),
+				rofs.WithRetention(time.Hour),
+				rofs.WithRetentionRecords(".retention"),
+				rofs.WithClock(clock.Now))
+			if err != nil {
+				t.Fatal(err)
+			}
+			expiry := clock.now.Add(time.Hour)
+
+			if err := ioutil.WriteFile(view, "/report.txt", []byte("v1"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			record := path.Join(dir, "report.txt.retention")
+			if data, err := ioutil.ReadFile(b.fs, record); err != nil || strings.TrimSpace(string(data)) != expiry.Format(time.RFC3339Nano) {
+				t.Fatalf("record: got %q, %v", data, err)
+			}
+
+			// records cannot be tampered with through the view
+			if err := ioutil.WriteFile(view, "/report.txt.retention", []byte("2099-01-01T00:00:00Z"), 0644); !errors.Is(err, rofs.ErrReadOnly) {
+				t.Errorf("writing a record: got %v", err)
+			}
+			if err := view.Remove("/report.txt.retention"); !errors.Is(err, rofs.ErrReadOnly) {
+				t.Errorf("removing a record: got %v", err)
+			}
+
+			// modifying the file does not extend the window
+			clock.Advance(30 * time.Minute)
+			if err := ioutil.WriteFile(view, "/report.txt", []byte("v2"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := view.Rename("/report.txt", "/final.txt"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := b.fs.Stat(path.Join(dir, "final.txt.retention")); err != nil {
+				t.Errorf("record was not moved: %v", err)
+			}
+
+			clock.Advance(30 * time.Minute)
+			var re *rofs.RetentionError
+			if err := ioutil.WriteFile(view, "/final.txt", []byte("v3"), 0644); !errors.As(err, &re) || !re.Expiry.Equal(expiry) {
+				t.Errorf("write after expiry: got %v", err)
+			}
+			if data, _ := ioutil.ReadFile(b.fs, path.Join(dir, "final.txt")); string(data) != "v2" {
+				t.Errorf("content: got %q", data)
+			}
+		})
+	}
+}
+
+func TestRetentionThroughSymlink(t *testing.T) {
+	mfs, err := memfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, mfs, "/old", "kept")
+	mtime := time.Now().Add(-48 * time.Hour)
+	if err := mfs.Chtimes("/old", mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if err := mfs.Symlink("/old", "/l"); err != nil {
+		t.Fatal(err)
+	}
+	z, err := rofs.NewFreezer(mfs, rofs.WithRetention(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var re *rofs.RetentionError
+	if _, err := z.OpenFile("/l", os.O_WRONLY|os.O_TRUNC, 0); !errors.As(err, &re) {
+		t.Errorf("OpenFile through a link: got %v, want *RetentionError", err)
+	}
+	if err := z.Truncate("/l", 0); !errors.As(err, &re) {
+		t.Errorf("Truncate through a link: got %v, want *RetentionError", err)
+	}
+	if data, err := ioutil.ReadFile(mfs, "/old"); err != nil || string(data) != "kept" {
+		t.Errorf("retained file = %q, %v", data, err)
+	}
+}
@@ -1,70 +1,278 @@
 package rofs
 
 import (
+	"io"
 	"io/fs"
 	"os"
+	"sync"
 
 	"github.com/absfs/absfs"
 )
 
 type File struct {
-	f absfs.File
+	f    absfs.File
+	fs   *FileSystem
+	name string
+	real string
+
+	// writable is set when the file was opened for writing inside a writable
+	// subtree or through an unlocked Switch; writes are then forwarded to the
+	// wrapped file.
+	writable bool
+
+	// appendOnly is set when the file lies in an append-only subtree; writes
+	// are then only accepted at its end.
+	appendOnly bool
+
+	// denied holds the capabilities refused on a file opened for writing
+	// outside the writable subtrees through WithCapabilities.
+	denied Capability
+
+	// drain is set when the file counts towards the open writers a Switch
+	// waits for in LockAndDrain.
+	drain bool
+
+	// closeOnce releases the file from the open writers of a Switch and
+	// seals it under WithSealOnClose.
+	closeOnce sync.Once
 }
 
+// Name returns the absolute name of the file as seen through the view it was
+// opened from.
 func (f *File) Name() string {
-	return f.f.Name()
+	return f.name
 }
 
-func (f *File) Read(p []byte) (int, error) {
+func (f *File) Read(p []byte) (n int, err error) {
+	if f.fs.opts.observer != nil {
+		e := f.observe("read")
+		defer func() { f.fs.observed(e, n, err) }()
+	}
 	return f.f.Read(p)
 }
 
 func (f *File) ReadAt(b []byte, off int64) (n int, err error) {
+	if f.fs.opts.observer != nil {
+		e := f.observe("read")
+		defer func() { f.fs.observed(e, n, err) }()
+	}
 	return f.f.ReadAt(b, off)
 }
 
-func (f *File) Write(p []byte) (int, error) {
-	return 0, &os.PathError{Op: "write", Path: f.f.Name(), Err: os.ErrPermission}
+func (f *File) Write(p []byte) (n int, err error) {
+	if f.fs.opts.observer != nil {
+		e := f.observe("write")
+		defer func() { f.fs.observed(e, n, err) }()
+	}
+	if !f.writable || f.denied&CapWrite != 0 {
+		return 0, f.fs.refused(readOnly("write", f.Name()))
+	}
+	if err := f.fs.retained("write", f.name, f.real); err != nil {
+		return 0, f.fs.refused(err)
+	}
+	if f.appendOnly && !f.atEnd() {
+		return 0, f.fs.refused(appendOnly("write", f.Name()))
+	}
+	done, err := f.fs.beginWrite("write", f.name)
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+	if f.switchLocked(CapWrite) {
+		return 0, f.fs.refused(readOnly("write", f.Name()))
+	}
+	n, err = f.f.Write(p)
+	return n, f.fs.translate(err)
 }
 
 func (f *File) WriteAt(b []byte, off int64) (n int, err error) {
-	return 0, &os.PathError{Op: "write", Path: f.f.Name(), Err: os.ErrPermission}
+	if f.fs.opts.observer != nil {
+		e := f.observe("write")
+		defer func() { f.fs.observed(e, n, err) }()
+	}
+	if !f.writable || f.denied&CapWrite != 0 {
+		return 0, f.fs.refused(readOnly("write", f.Name()))
+	}
+	if err := f.fs.retained("write", f.name, f.real); err != nil {
+		return 0, f.fs.refused(err)
+	}
+	if f.appendOnly {
+		return 0, f.fs.refused(appendOnly("write", f.Name()))
+	}
+	done, err := f.fs.beginWrite("write", f.name)
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+	if f.switchLocked(CapWrite) {
+		return 0, f.fs.refused(readOnly("write", f.Name()))
+	}
+	n, err = f.f.WriteAt(b, off)
+	return n, f.fs.translate(err)
 }
 
-func (f *File) Close() error {
-	return f.f.Close()
+// switchLocked reports whether the file was opened for writing through a
+// Switch that has been locked since, and may no longer be written to with
+// the capabilities need. The caller must be inside beginWrite.
+func (f *File) switchLocked(need Capability) bool {
+	sw := f.fs.sw
+	return sw != nil && sw.locked && !f.fs.inWritable(f.real) && !f.fs.granted(need)
+}
+
+func (f *File) Close() (err error) {
+	if f.fs.opts.observer != nil {
+		e := f.observe("close")
+		defer func() { f.fs.observed(e, 0, err) }()
+	}
+	err = f.f.Close()
+	if f.writable {
+		f.closeOnce.Do(func() {
+			if f.drain {
+				f.fs.sw.removeWriter()
+			}
+			if s := f.fs.opts.seal; s != nil {
+				if serr := s.seal(f.fs.fs, f.real); serr != nil && err == nil {
+					err = &fs.PathError{Op: "close", Path: f.name, Err: serr}
+				}
+			}
+		})
+	}
+	return err
 }
 
 func (f *File) Seek(offset int64, whence int) (ret int64, err error) {
+	if f.fs.opts.observer != nil {
+		e := f.observe("seek")
+		defer func() { f.fs.observed(e, 0, err) }()
+	}
 	return f.f.Seek(offset, whence)
 }
 
-func (f *File) Stat() (os.FileInfo, error) {
-	return f.f.Stat()
+func (f *File) Stat() (_ os.FileInfo, err error) {
+	if f.fs.opts.observer != nil {
+		e := f.observe("stat")
+		defer func() { f.fs.observed(e, 0, err) }()
+	}
+	info, err := f.f.Stat()
+	return f.fs.info(info), err
 }
 
-func (f *File) Sync() error {
-	return nil
+func (f *File) Sync() (err error) {
+	if f.fs.opts.observer != nil {
+		e := f.observe("sync")
+		defer func() { f.fs.observed(e, 0, err) }()
+	}
+	if !f.writable {
+		return nil
+	}
+	return f.fs.translate(f.f.Sync())
 }
 
-func (f *File) Readdir(n int) ([]os.FileInfo, error) {
-	return f.f.Readdir(n)
+func (f *File) Readdir(n int) (_ []os.FileInfo, err error) {
+	if f.fs.opts.observer != nil {
+		e := f.observe("readdir")
+		defer func() { f.fs.observed(e, 0, err) }()
+	}
+	infos, err := readdir(f, n, f.f.Readdir, os.FileInfo.Name)
+	return f.fs.infos(infos), err
 }
 
-func (f *File) Readdirnames(n int) ([]string, error) {
-	return f.f.Readdirnames(n)
+func (f *File) Readdirnames(n int) (_ []string, err error) {
+	if f.fs.opts.observer != nil {
+		e := f.observe("readdir")
+		defer func() { f.fs.observed(e, 0, err) }()
+	}
+	return readdir(f, n, f.f.Readdirnames, func(name string) string { return name })
 }
 
-func (f *File) Truncate(size int64) error {
-	return &os.PathError{Op: "write", Path: f.f.Name(), Err: os.ErrPermission}
+func (f *File) Truncate(size int64) (err error) {
+	if f.fs.opts.observer != nil {
+		e := f.observe("truncate")
+		defer func() { f.fs.observed(e, 0, err) }()
+	}
+	if !f.writable || f.denied&CapTruncate != 0 {
+		return f.fs.refused(readOnly("truncate", f.Name()))
+	}
+	if err := f.fs.retained("truncate", f.name, f.real); err != nil {
+		return f.fs.refused(err)
+	}
+	if f.appendOnly {
+		return f.fs.refused(appendOnly("truncate", f.Name()))
+	}
+	done, err := f.fs.beginWrite("truncate", f.name)
+	if err != nil {
+		return err
+	}
+	defer done()
+	if f.switchLocked(CapTruncate) {
+		return f.fs.refused(readOnly("truncate", f.Name()))
+	}
+	return f.fs.translate(f.f.Truncate(size))
 }
 
 func (f *File) WriteString(s string) (n int, err error) {
-	return 0, &os.PathError{Op: "write", Path: f.f.Name(), Err: os.ErrPermission}
+	if f.fs.opts.observer != nil {
+		e := f.observe("write")
+		defer func() { f.fs.observed(e, n, err) }()
+	}
+	if !f.writable || f.denied&CapWrite != 0 {
+		return 0, f.fs.refused(readOnly("write", f.Name()))
+	}
+	if err := f.fs.retained("write", f.name, f.real); err != nil {
+		return 0, f.fs.refused(err)
+	}
+	if f.appendOnly && !f.atEnd() {
+		return 0, f.fs.refused(appendOnly("write", f.Name()))
+	}
+	done, err := f.fs.beginWrite("write", f.name)
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+	if f.switchLocked(CapWrite) {
+		return 0, f.fs.refused(readOnly("write", f.Name()))
+	}
+	n, err = f.f.WriteString(s)
+	return n, f.fs.translate(err)
 }
 
 // ReadDir reads the contents of the directory and returns a slice of up to n
 // DirEntry values. This is a read operation, so it's allowed in read-only mode.
-func (f *File) ReadDir(n int) ([]fs.DirEntry, error) {
-	return f.f.ReadDir(n)
+func (f *File) ReadDir(n int) (_ []fs.DirEntry, err error) {
+	if f.fs.opts.observer != nil {
+		e := f.observe("readdir")
+		defer func() { f.fs.observed(e, 0, err) }()
+	}
+	entries, err := readdir(f, n, f.f.ReadDir, fs.DirEntry.Name)
+	return f.fs.entries(entries), err
+}
+
+// readdir reads directory entries with read and leaves out the ones hidden by
+// the rules of the view. When n > 0 it keeps reading until it has n visible
+// entries or reaches the end of the directory, so callers paging through a
+// directory see the same contract as an unfiltered one.
+func readdir[T any](f *File, n int, read func(int) ([]T, error), name func(T) string) ([]T, error) {
+	if len(f.fs.opts.rules) == 0 {
+		return read(n)
+	}
+	if n <= 0 {
+		list, err := read(n)
+		return visible(f.fs, f.real, list, name), err
+	}
+
+	var out []T
+	for len(out) < n {
+		list, err := read(n - len(out))
+		out = append(out, visible(f.fs, f.real, list, name)...)
+		if err != nil {
+			if err == io.EOF && len(out) > 0 {
+				return out, nil
+			}
+			return out, err
+		}
+		if len(list) == 0 {
+			break
+		}
+	}
+	return out, nil
 }
@@ -1,8 +1,14 @@
 package rofs
 
 import (
+	"context"
+	"io"
 	"io/fs"
 	"os"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/absfs/absfs"
@@ -10,81 +16,365 @@ import (
 
 type FileSystem struct {
 	fs absfs.SymlinkFileSystem
+
+	// root is the directory of the wrapped filesystem that appears as "/" in
+	// this view. It is "/" unless the view was created with SubFS.
+	root string
+
+	opts options
+
+	// sw is set for views of a Switch, fz for views of a Freezer and ov for
+	// views of a DryRun.
+	sw *switchState
+	fz *freezeState
+	ov *overlay
+
+	// ctx is the context set with WithContext, or nil.
+	ctx context.Context
+
+	// cwd is the working directory of this view. It is kept separately from
+	// the wrapped filesystem so that changing directory through a read-only
+	// view never affects other users of the same backend.
+	mu  sync.RWMutex
+	cwd string
+}
+
+// NewFS returns a read-only view of fs. The view starts in the working
+// directory fs reports at the time of the call, and tracks its own working
+// directory from then on.
+func NewFS(fs absfs.SymlinkFileSystem, opts ...Option) (*FileSystem, error) {
+	f, err := newFS(fs, opts)
+	if err != nil || f.opts.scratch == nil {
+		return f, err
+	}
+	ov, err := newOverlay(fs, f.opts.scratch)
+	if err != nil {
+		return nil, err
+	}
+	f.fs, f.ov = ov, ov
+	return f, nil
+}
+
+// newFS is NewFS without the scratch layer.
+func newFS(fs absfs.SymlinkFileSystem, opts []Option) (*FileSystem, error) {
+	o := defaultOptions()
+	if err := o.apply("/", opts); err != nil {
+		return nil, err
+	}
+
+	cwd, err := fs.Getwd()
+	if err != nil || cwd == "" {
+		cwd = "/"
+	}
+	return &FileSystem{fs: fs, root: "/", opts: o, cwd: path.Clean(cwd)}, nil
+}
+
+// SubFS returns a read-only view of the subtree rooted at dir. Paths in the
+// new view are confined lexically to dir, so ".." cannot be used to reach
+// anything above it, and the paths reported in errors and by File.Name are
+// relative to the new root. The new view starts with "/" as its working
+// directory.
+//
+// The new view inherits the options of f; opts are applied on top of them.
+func (f *FileSystem) SubFS(dir string, opts ...Option) (*FileSystem, error) {
+	root, err := f.locate("sub", dir, true)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.fs.Stat(root)
+	if err != nil {
+		return nil, &os.PathError{Op: "sub", Path: dir, Err: underlying(err)}
+	}
+	if !info.IsDir() {
+		return nil, &os.PathError{Op: "sub", Path: dir, Err: syscall.ENOTDIR}
+	}
+	o := f.opts
+	if err := o.apply(root, opts); err != nil {
+		return nil, err
+	}
+	return f.view(root, o, "/"), nil
+}
+
+// WithContext returns a copy of the view whose operations are carried out on
+// behalf of ctx. The copy starts in the working directory of f. ctx bounds
+// how long mutating operations may wait on a frozen Freezer.
+func (f *FileSystem) WithContext(ctx context.Context) *FileSystem {
+	if ctx == nil {
+		panic("rofs: nil context")
+	}
+	cwd, _ := f.Getwd()
+	v := f.view(f.root, f.opts, cwd)
+	v.ctx = ctx
+	return v
+}
+
+// Context returns the context of the view, or context.Background if none was
+// set with WithContext.
+func (f *FileSystem) Context() context.Context {
+	if f.ctx == nil {
+		return context.Background()
+	}
+	return f.ctx
 }
 
-func NewFS(fs absfs.SymlinkFileSystem) (*FileSystem, error) {
-	return &FileSystem{fs}, nil
+// view returns a new view sharing the backend and state of f.
+func (f *FileSystem) view(root string, o options, cwd string) *FileSystem {
+	return &FileSystem{fs: f.fs, root: root, opts: o, sw: f.sw, fz: f.fz, ov: f.ov, ctx: f.ctx, cwd: cwd}
 }
 
 // FileSystem interface
 
-// OpenFile opens a file using the given flags and the given mode.
-func (f *FileSystem) OpenFile(name string, flag int, perm os.FileMode) (absfs.File, error) {
-	// error if access mode is not readonly
-	if flag&absfs.O_ACCESS != os.O_RDONLY {
-		return nil, os.ErrPermission
+// writeFlags are the OpenFile flag bits that can create, truncate or extend a
+// file even when the access mode is O_RDONLY.
+const writeFlags = absfs.O_CREATE | absfs.O_TRUNC | absfs.O_APPEND | absfs.O_EXCL
+
+// OpenFile opens a file using the given flags and the given mode. Outside
+// the writable subtrees only O_RDONLY access is permitted, and any flag that
+// could modify the wrapped filesystem (O_CREATE, O_TRUNC, O_APPEND or O_EXCL)
+// is rejected with a *PathError, unless the view grants the capabilities the
+// flags need as described for WithCapabilities.
+// Inside append-only subtrees the flags are restricted as described for
+// WithAppendOnly.
+func (f *FileSystem) OpenFile(name string, flag int, perm os.FileMode) (_ absfs.File, err error) {
+	if f.opts.observer != nil {
+		e := f.observe("open", name, "", flag)
+		defer func() { f.observed(e, 0, err) }()
+	}
+	// the access mode is not readonly, or a flag could mutate the underlying
+	// filesystem
+	writing := flag&absfs.O_ACCESS != os.O_RDONLY || flag&writeFlags != 0
+
+	if !writing {
+		real, err := f.locate("open", name, true)
+		if err != nil {
+			return nil, err
+		}
+		file, err := f.fs.OpenFile(real, flag, perm)
+		if err != nil {
+			return nil, f.translate(err)
+		}
+		return &File{f: file, fs: f, name: f.abs(name), real: real}, nil
 	}
 
-	file, err := f.fs.OpenFile(name, flag, perm)
-	return &File{file}, err
+	real, done, err := f.writePath("open", f.openCaps(name, flag), name, true)
+	if err != nil {
+		return nil, f.refusedFlags(err, flag)
+	}
+	defer done()
+	ao := f.appendOnly(f.real(name), real)
+	if ao && !appendFlags(flag) {
+		return nil, f.refusedFlags(appendOnly("open", name), flag)
+	}
+	created := false
+	if f.opts.retention > 0 {
+		if _, err := f.fs.Lstat(real); err == nil {
+			if err := f.locked("open", name, real, false); err != nil {
+				return nil, f.refusedFlags(err, flag)
+			}
+		} else {
+			created = flag&absfs.O_CREATE != 0
+		}
+	}
+	file, err := f.fs.OpenFile(real, flag, perm)
+	if err != nil {
+		return nil, f.translate(err)
+	}
+	if created {
+		if err := f.recordCreated(real); err != nil {
+			file.Close()
+			return nil, f.translate(err)
+		}
+	}
+	if ao && flag&absfs.O_APPEND != 0 {
+		if _, err := file.Seek(0, io.SeekEnd); err != nil {
+			file.Close()
+			return nil, f.translate(err)
+		}
+	}
+	wf := &File{f: file, fs: f, name: f.abs(name), real: real, writable: true, appendOnly: ao}
+	if !f.forwardAll() && !f.inWritable(real) {
+		// opened through WithCapabilities
+		wf.denied = CapAll &^ f.opts.caps
+	}
+	if f.sw != nil && !f.sw.locked && !f.inWritable(real) {
+		// only files the lock will stop from writing are drained
+		wf.drain = true
+		f.sw.addWriter()
+	}
+	return wf, nil
 }
 
 // Mkdir creates a directory in the filesystem, return an error if any
 // happens.
-func (f *FileSystem) Mkdir(name string, perm os.FileMode) error {
-	return os.ErrPermission
+func (f *FileSystem) Mkdir(name string, perm os.FileMode) (err error) {
+	if f.opts.observer != nil {
+		e := f.observe("mkdir", name, "", 0)
+		defer func() { f.observed(e, 0, err) }()
+	}
+	real, done, err := f.writePath("mkdir", CapMkdir, name, false)
+	if err != nil {
+		return f.refused(err)
+	}
+	defer done()
+	return f.translate(f.fs.Mkdir(real, perm))
 }
 
 // Remove removes a file identified by name, returning an error, if any
 // happens.
-func (f *FileSystem) Remove(name string) error {
-	return os.ErrPermission
+func (f *FileSystem) Remove(name string) (err error) {
+	if f.opts.observer != nil {
+		e := f.observe("remove", name, "", 0)
+		defer func() { f.observed(e, 0, err) }()
+	}
+	real, done, err := f.writePath("remove", CapRemove, name, false)
+	if err != nil {
+		return f.refused(err)
+	}
+	defer done()
+	if err := f.fs.Remove(real); err != nil {
+		return f.translate(err)
+	}
+	f.removeRecord(real)
+	return nil
 }
 
 // Rename renames (moves) oldpath to newpath. If newpath already exists and
 // is not a directory, Rename replaces it. OS-specific restrictions may apply
 // when oldpath and newpath are in different directories. If there is an
 // error, it will be of type *LinkError.
-func (f *FileSystem) Rename(oldpath, newpath string) error {
-	return &os.LinkError{
-		Op:  "rename",
-		Old: oldpath,
-		New: newpath,
-		Err: os.ErrPermission,
+func (f *FileSystem) Rename(oldpath, newpath string) (err error) {
+	if f.opts.observer != nil {
+		e := f.observe("rename", oldpath, f.abs(newpath), 0)
+		defer func() { f.observed(e, 0, err) }()
+	}
+	oldreal, newreal, done, err := f.writePaths("rename", CapRename, oldpath, newpath)
+	if err != nil {
+		return f.refused(err)
+	}
+	defer done()
+	if err := f.fs.Rename(oldreal, newreal); err != nil {
+		return f.translate(err)
 	}
+	f.moveRecord(oldreal, newreal)
+	return nil
 }
 
 // Stat returns the FileInfo structure describing file. If there is an error,
 // it will be of type *PathError.
-func (f *FileSystem) Stat(name string) (os.FileInfo, error) {
-	return f.fs.Stat(name)
+func (f *FileSystem) Stat(name string) (_ os.FileInfo, err error) {
+	if f.opts.observer != nil {
+		e := f.observe("stat", name, "", 0)
+		defer func() { f.observed(e, 0, err) }()
+	}
+	real, err := f.locate("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.fs.Stat(real)
+	return f.info(info), f.translate(err)
 }
 
-//Chmod changes the mode of the named file to mode.
-func (f *FileSystem) Chmod(name string, mode os.FileMode) error {
-	return os.ErrPermission
+// Chmod changes the mode of the named file to mode.
+func (f *FileSystem) Chmod(name string, mode os.FileMode) (err error) {
+	if f.opts.observer != nil {
+		e := f.observe("chmod", name, "", 0)
+		defer func() { f.observed(e, 0, err) }()
+	}
+	real, done, err := f.writePath("chmod", CapChmod, name, true)
+	if err != nil {
+		return f.refused(err)
+	}
+	defer done()
+	if f.appendOnly(f.real(name), real) {
+		grows, err := f.addsWriteBits(real, mode)
+		if err != nil {
+			return f.translate(err)
+		}
+		if grows {
+			return f.refused(appendOnly("chmod", name))
+		}
+	}
+	return f.translate(f.fs.Chmod(real, mode))
 }
 
-//Chtimes changes the access and modification times of the named file
-func (f *FileSystem) Chtimes(name string, atime time.Time, mtime time.Time) error {
-	return os.ErrPermission
+// Chtimes changes the access and modification times of the named file
+func (f *FileSystem) Chtimes(name string, atime time.Time, mtime time.Time) (err error) {
+	if f.opts.observer != nil {
+		e := f.observe("chtimes", name, "", 0)
+		defer func() { f.observed(e, 0, err) }()
+	}
+	real, done, err := f.writePath("chtimes", CapChtimes, name, true)
+	if err != nil {
+		return f.refused(err)
+	}
+	defer done()
+	if f.extendsRetention(real, mtime) {
+		return f.refused(readOnly("chtimes", name))
+	}
+	return f.translate(f.fs.Chtimes(real, atime, mtime))
 }
 
-//Chown changes the owner and group ids of the named file
-func (f *FileSystem) Chown(name string, uid, gid int) error {
-	return os.ErrPermission
+// Chown changes the owner and group ids of the named file
+func (f *FileSystem) Chown(name string, uid, gid int) (err error) {
+	if f.opts.observer != nil {
+		e := f.observe("chown", name, "", 0)
+		defer func() { f.observed(e, 0, err) }()
+	}
+	real, done, err := f.writePath("chown", CapChown, name, true)
+	if err != nil {
+		return f.refused(err)
+	}
+	defer done()
+	return f.translate(f.fs.Chown(real, uid, gid))
 }
 
-func (f *FileSystem) Chdir(dir string) error {
-	return f.fs.Chdir(dir)
+// Chdir changes the working directory of this view. The working directory of
+// the wrapped filesystem is left untouched, so several views over the same
+// backend can each hold a different working directory.
+func (f *FileSystem) Chdir(dir string) (err error) {
+	if f.opts.observer != nil {
+		e := f.observe("chdir", dir, "", 0)
+		defer func() { f.observed(e, 0, err) }()
+	}
+	real, err := f.locate("chdir", dir, true)
+	if err != nil {
+		return err
+	}
+	info, err := f.fs.Stat(real)
+	if err != nil {
+		return &os.PathError{Op: "chdir", Path: dir, Err: underlying(err)}
+	}
+	if !info.IsDir() {
+		return &os.PathError{Op: "chdir", Path: dir, Err: syscall.ENOTDIR}
+	}
+
+	name := f.abs(dir)
+	f.mu.Lock()
+	f.cwd = name
+	f.mu.Unlock()
+	return nil
 }
 
+// Getwd returns the working directory of this view.
 func (f *FileSystem) Getwd() (dir string, err error) {
-	return f.fs.Getwd()
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.cwd, nil
 }
 
+// TempDir returns the temporary directory of the wrapped filesystem as a path
+// of the view. It returns "" for a view derived with SubFS whose root does not
+// contain that directory, since the view has no name for it.
 func (f *FileSystem) TempDir() string {
-	return f.fs.TempDir()
+	dir := f.fs.TempDir()
+	if f.root == "/" || dir == "" {
+		return dir
+	}
+	dir = path.Clean(dir)
+	if dir != f.root && !strings.HasPrefix(dir, f.root+"/") {
+		return ""
+	}
+	return f.virtual(dir)
 }
 
 func (f *FileSystem) Open(name string) (absfs.File, error) {
@@ -92,26 +382,66 @@ func (f *FileSystem) Open(name string) (absfs.File, error) {
 }
 
 func (f *FileSystem) Create(name string) (absfs.File, error) {
-	return nil, os.ErrPermission
+	return f.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
 }
 
-func (f *FileSystem) MkdirAll(name string, perm os.FileMode) error {
-	return os.ErrPermission
+func (f *FileSystem) MkdirAll(name string, perm os.FileMode) (err error) {
+	if f.opts.observer != nil {
+		e := f.observe("mkdirall", name, "", 0)
+		defer func() { f.observed(e, 0, err) }()
+	}
+	real, done, err := f.writePath("mkdir", CapMkdir, name, true)
+	if err != nil {
+		return f.refused(err)
+	}
+	defer done()
+	return f.translate(f.fs.MkdirAll(real, perm))
 }
 
 func (f *FileSystem) RemoveAll(path string) (err error) {
-	return os.ErrPermission
+	if f.opts.observer != nil {
+		e := f.observe("removeall", path, "", 0)
+		defer func() { f.observed(e, 0, err) }()
+	}
+	real, done, err := f.writePath("removeall", CapRemove, path, false)
+	if err != nil {
+		return f.refused(err)
+	}
+	defer done()
+	if err := f.fs.RemoveAll(real); err != nil {
+		return f.translate(err)
+	}
+	f.removeRecord(real)
+	return nil
 }
 
-func (f *FileSystem) Truncate(name string, size int64) error {
-	return os.ErrPermission
+func (f *FileSystem) Truncate(name string, size int64) (err error) {
+	if f.opts.observer != nil {
+		e := f.observe("truncate", name, "", 0)
+		defer func() { f.observed(e, 0, err) }()
+	}
+	real, done, err := f.writePath("truncate", CapTruncate, name, true)
+	if err != nil {
+		return f.refused(err)
+	}
+	defer done()
+	return f.translate(f.fs.Truncate(real, size))
 }
 
 // Lstat returns a FileInfo describing the named file. If the file is a
 // symbolic link, the returned FileInfo describes the symbolic link. Lstat
 // makes no attempt to follow the link. If there is an error, it will be of type *PathError.
-func (f *FileSystem) Lstat(name string) (os.FileInfo, error) {
-	return f.fs.Lstat(name)
+func (f *FileSystem) Lstat(name string) (_ os.FileInfo, err error) {
+	if f.opts.observer != nil {
+		e := f.observe("lstat", name, "", 0)
+		defer func() { f.observed(e, 0, err) }()
+	}
+	real, err := f.locate("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.fs.Lstat(real)
+	return f.info(info), f.translate(err)
 }
 
 // Lchown changes the numeric uid and gid of the named file. If the file is a
@@ -120,46 +450,87 @@ func (f *FileSystem) Lstat(name string) (os.FileInfo, error) {
 //
 // On Windows, it always returns the syscall.EWINDOWS error, wrapped in
 // `*PathError`.
-func (f *FileSystem) Lchown(name string, uid, gid int) error {
-	// return f.fs.Lchown(name, uid, gid)
-	return &os.PathError{
-		Op:   "lchown",
-		Path: name,
-		Err:  os.ErrPermission,
+func (f *FileSystem) Lchown(name string, uid, gid int) (err error) {
+	if f.opts.observer != nil {
+		e := f.observe("lchown", name, "", 0)
+		defer func() { f.observed(e, 0, err) }()
+	}
+	real, done, err := f.writePath("lchown", CapChown, name, false)
+	if err != nil {
+		return f.refused(err)
 	}
+	defer done()
+	return f.translate(f.fs.Lchown(real, uid, gid))
 }
 
 // Readlink returns the destination of the named symbolic link. If there is an
 // error, it will be of type *PathError.
-func (f *FileSystem) Readlink(name string) (string, error) {
-	return f.fs.Readlink(name)
+func (f *FileSystem) Readlink(name string) (_ string, err error) {
+	if f.opts.observer != nil {
+		e := f.observe("readlink", name, "", 0)
+		defer func() { f.observed(e, 0, err) }()
+	}
+	real, err := f.locate("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	target, err := f.fs.Readlink(real)
+	return target, f.translate(err)
 }
 
 // Symlink creates newname as a symbolic link to oldname. If there is an
 // error, it will be of type *LinkError.
-func (f *FileSystem) Symlink(oldname, newname string) error {
-	return &os.LinkError{
-		Op:  "symlink",
-		Old: oldname,
-		New: newname,
-		Err: os.ErrPermission,
+func (f *FileSystem) Symlink(oldname, newname string) (err error) {
+	if f.opts.observer != nil {
+		e := f.observe("symlink", newname, oldname, 0)
+		defer func() { f.observed(e, 0, err) }()
+	}
+	real, done, err := f.writePath("symlink", CapSymlink, newname, false)
+	if err != nil {
+		return f.refused(&os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: underlying(err)})
 	}
+	defer done()
+	return f.translate(f.fs.Symlink(oldname, real))
 }
 
 // ReadDir reads the named directory and returns a list of directory entries.
 // This is a read operation, so it's allowed in read-only mode.
-func (f *FileSystem) ReadDir(name string) ([]fs.DirEntry, error) {
-	return f.fs.ReadDir(name)
+func (f *FileSystem) ReadDir(name string) (_ []fs.DirEntry, err error) {
+	if f.opts.observer != nil {
+		e := f.observe("readdir", name, "", 0)
+		defer func() { f.observed(e, 0, err) }()
+	}
+	real, err := f.locate("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := f.fs.ReadDir(real)
+	entries = visible(f, real, entries, fs.DirEntry.Name)
+	return f.entries(entries), f.translate(err)
 }
 
 // ReadFile reads the named file and returns its contents.
 // This is a read operation, so it's allowed in read-only mode.
-func (f *FileSystem) ReadFile(name string) ([]byte, error) {
-	return f.fs.ReadFile(name)
+func (f *FileSystem) ReadFile(name string) (data []byte, err error) {
+	if f.opts.observer != nil {
+		e := f.observe("readfile", name, "", 0)
+		defer func() { f.observed(e, len(data), err) }()
+	}
+	real, err := f.locate("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	data, err = f.fs.ReadFile(real)
+	return data, f.translate(err)
 }
 
 // Sub returns an fs.FS corresponding to the subtree rooted at dir.
-// The result is wrapped in rofs to maintain read-only guarantee.
+// The result is an *IOFS over a read-only view of the subtree. Use SubFS to
+// keep the full absfs API.
 func (f *FileSystem) Sub(dir string) (fs.FS, error) {
-	return absfs.FilerToFS(f, dir)
+	sub, err := f.SubFS(dir)
+	if err != nil {
+		return nil, err
+	}
+	return sub.IOFS(), nil
 }
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"io"
 	"os"
+	"path"
+	"reflect"
 	"testing"
 	"time"
 
@@ -344,8 +346,8 @@ func TestFileWriteOperationsReturnPermissionError(t *testing.T) {
 		if !errors.As(err, &pathErr) {
 			t.Errorf("Truncate: expected *os.PathError, got %T", err)
 		} else {
-			if pathErr.Op != "write" {
-				t.Errorf("PathError.Op: expected 'write', got %q", pathErr.Op)
+			if pathErr.Op != "truncate" {
+				t.Errorf("PathError.Op: expected 'truncate', got %q", pathErr.Op)
 			}
 			if !errors.Is(pathErr.Err, os.ErrPermission) {
 				t.Errorf("PathError.Err: expected os.ErrPermission, got %v", pathErr.Err)
@@ -379,16 +381,13 @@ func TestOpenFileFlagsValidation(t *testing.T) {
 		}
 	})
 
-	// Note: The rofs implementation only checks the access mode (O_RDONLY, O_WRONLY, O_RDWR),
-	// not additional flags like O_APPEND, O_CREATE, O_TRUNC. Those flags are passed through
-	// to the underlying filesystem which handles them appropriately.
-	t.Run("O_APPEND with O_RDONLY succeeds (access mode is RDONLY)", func(t *testing.T) {
+	t.Run("O_APPEND with O_RDONLY returns ErrPermission", func(t *testing.T) {
 		f, err := rfs.OpenFile("/testdir/file.txt", os.O_RDONLY|os.O_APPEND, 0644)
-		if err != nil {
-			t.Errorf("expected no error, got %v", err)
-		}
 		if f != nil {
-			f.Close()
+			t.Error("expected nil file")
+		}
+		if !errors.Is(err, os.ErrPermission) {
+			t.Errorf("expected os.ErrPermission, got %v", err)
 		}
 	})
 
@@ -443,6 +442,131 @@ func TestOpenFileFlagsValidation(t *testing.T) {
 	})
 }
 
+// backend describes a writable filesystem and a directory inside it that the
+// flag conformance tests may use.
+type backend struct {
+	name string
+	fs   absfs.SymlinkFileSystem
+	dir  string
+}
+
+func testBackends(t *testing.T) []backend {
+	t.Helper()
+	mfs, err := memfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mfs.MkdirAll("/conformance", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return []backend{
+		{"memfs", mfs, "/conformance"},
+		{"osfs", ofs, osfs.FromNative(t.TempDir())},
+	}
+}
+
+// snapshot returns the names and contents of every regular file in dir.
+func snapshot(t *testing.T, fs absfs.FileSystem, dir string) map[string]string {
+	t.Helper()
+	entries, err := fs.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make(map[string]string)
+	for _, e := range entries {
+		if e.IsDir() {
+			out[e.Name()] = "<dir>"
+			continue
+		}
+		data, err := fs.ReadFile(path.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out[e.Name()] = string(data)
+	}
+	return out
+}
+
+func TestOpenFileFlagPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		flag   int
+		denied bool
+	}{
+		{"O_RDONLY", "existing.txt", os.O_RDONLY, false},
+		{"O_RDONLY|O_SYNC", "existing.txt", os.O_RDONLY | os.O_SYNC, false},
+		{"O_WRONLY", "existing.txt", os.O_WRONLY, true},
+		{"O_RDWR", "existing.txt", os.O_RDWR, true},
+		{"O_RDONLY|O_CREATE existing", "existing.txt", os.O_RDONLY | os.O_CREATE, true},
+		{"O_RDONLY|O_CREATE missing", "missing.txt", os.O_RDONLY | os.O_CREATE, true},
+		{"O_RDONLY|O_TRUNC", "existing.txt", os.O_RDONLY | os.O_TRUNC, true},
+		{"O_RDONLY|O_APPEND", "existing.txt", os.O_RDONLY | os.O_APPEND, true},
+		{"O_RDONLY|O_EXCL", "existing.txt", os.O_RDONLY | os.O_EXCL, true},
+		{"O_RDONLY|O_CREATE|O_EXCL", "missing.txt", os.O_RDONLY | os.O_CREATE | os.O_EXCL, true},
+		{"O_RDONLY|O_CREATE|O_TRUNC", "existing.txt", os.O_RDONLY | os.O_CREATE | os.O_TRUNC, true},
+		{"O_WRONLY|O_APPEND", "existing.txt", os.O_WRONLY | os.O_APPEND, true},
+		{"O_RDWR|O_CREATE|O_TRUNC", "missing.txt", os.O_RDWR | os.O_CREATE | os.O_TRUNC, true},
+	}
+
+	for _, b := range testBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			existing := path.Join(b.dir, "existing.txt")
+			if err := ioutil.WriteFile(b.fs, existing, []byte("original"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			before := snapshot(t, b.fs, b.dir)
+
+			rfs, err := rofs.NewFS(b.fs)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					name := path.Join(b.dir, tt.file)
+					f, err := rfs.OpenFile(name, tt.flag, 0644)
+					if !tt.denied {
+						if err != nil {
+							t.Fatalf("OpenFile(%s): unexpected error %v", absfs.Flags(tt.flag), err)
+						}
+						f.Close()
+						return
+					}
+
+					if f != nil {
+						t.Errorf("OpenFile(%s): expected nil file", absfs.Flags(tt.flag))
+					}
+					var pathErr *os.PathError
+					if !errors.As(err, &pathErr) {
+						t.Fatalf("OpenFile(%s): expected *os.PathError, got %T %v", absfs.Flags(tt.flag), err, err)
+					}
+					if pathErr.Op != "open" {
+						t.Errorf("PathError.Op: expected 'open', got %q", pathErr.Op)
+					}
+					if pathErr.Path != name {
+						t.Errorf("PathError.Path: expected %q, got %q", name, pathErr.Path)
+					}
+					if !errors.Is(err, os.ErrPermission) {
+						t.Errorf("OpenFile(%s): expected os.ErrPermission, got %v", absfs.Flags(tt.flag), err)
+					}
+				})
+			}
+
+			after := snapshot(t, b.fs, b.dir)
+			if !reflect.DeepEqual(before, after) {
+				t.Errorf("underlying filesystem changed:\nbefore: %v\nafter:  %v", before, after)
+			}
+		})
+	}
+}
+
 // Phase 3: Test File Read Operations
 
 func TestFileReadOperations(t *testing.T) {
@@ -1039,3 +1163,100 @@ func TestWithOSFS(t *testing.T) {
 		entries.Close()
 	}
 }
+
+func TestPerViewWorkingDirectory(t *testing.T) {
+	rfs1, wfs := setupTestFS(t)
+	rfs2, err := rofs.NewFS(wfs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := wfs.Chdir("/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rfs1.Chdir("/testdir"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rfs2.Chdir("/testdir/subdir"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("backend working directory is unchanged", func(t *testing.T) {
+		wd, err := wfs.Getwd()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wd != "/" {
+			t.Errorf("backend Getwd: expected '/', got %q", wd)
+		}
+	})
+
+	t.Run("each view keeps its own working directory", func(t *testing.T) {
+		for _, tt := range []struct {
+			fs   *rofs.FileSystem
+			want string
+		}{{rfs1, "/testdir"}, {rfs2, "/testdir/subdir"}} {
+			wd, err := tt.fs.Getwd()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if wd != tt.want {
+				t.Errorf("Getwd: expected %q, got %q", tt.want, wd)
+			}
+		}
+	})
+
+	t.Run("relative paths resolve against the view", func(t *testing.T) {
+		data, err := rfs1.ReadFile("file.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "test content" {
+			t.Errorf("ReadFile: expected 'test content', got %q", data)
+		}
+
+		data, err = ioutil.ReadFile(rfs2, "nested.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "nested content" {
+			t.Errorf("ReadFile: expected 'nested content', got %q", data)
+		}
+
+		if _, err := rfs2.Stat("file.txt"); err == nil {
+			t.Error("Stat file.txt in /testdir/subdir: expected error")
+		}
+		if _, err := wfs.Stat("empty.txt"); err != nil {
+			t.Errorf("backend Stat empty.txt: unexpected error %v", err)
+		}
+	})
+
+	t.Run("relative Chdir", func(t *testing.T) {
+		if err := rfs1.Chdir("subdir"); err != nil {
+			t.Fatal(err)
+		}
+		wd, _ := rfs1.Getwd()
+		if wd != "/testdir/subdir" {
+			t.Errorf("Getwd: expected '/testdir/subdir', got %q", wd)
+		}
+		if err := rfs1.Chdir(".."); err != nil {
+			t.Fatal(err)
+		}
+		wd, _ = rfs1.Getwd()
+		if wd != "/testdir" {
+			t.Errorf("Getwd: expected '/testdir', got %q", wd)
+		}
+	})
+
+	t.Run("Chdir to a file fails", func(t *testing.T) {
+		err := rfs1.Chdir("/testdir/file.txt")
+		var pathErr *os.PathError
+		if !errors.As(err, &pathErr) || pathErr.Op != "chdir" {
+			t.Errorf("expected chdir *os.PathError, got %v", err)
+		}
+		wd, _ := rfs1.Getwd()
+		if wd != "/testdir" {
+			t.Errorf("failed Chdir changed working directory to %q", wd)
+		}
+	})
+}
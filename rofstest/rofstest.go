@@ -0,0 +1,176 @@
+// Package rofstest provides test helpers for code running on rofs views and
+// for filesystems claiming read-only semantics.
+package rofstest
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/rofs"
+)
+
+// AssertNoWrites runs fn on a read-only rofs view of fsys and fails t if fn
+// attempted to modify it. Each refused operation is listed with its op, path
+// and the function that made it.
+//
+// The tree below the working directory of fsys is compared before and after
+// fn runs as well, to catch writes that went around the view, for example
+// through a reference to fsys itself.
+func AssertNoWrites(t testing.TB, fsys absfs.SymlinkFileSystem, fn func(fs absfs.SymlinkFileSystem)) {
+	t.Helper()
+	root, err := fsys.Getwd()
+	if err != nil || root == "" {
+		root = "/"
+	}
+	before, err := snapshot(fsys, root)
+	if err != nil {
+		t.Fatalf("rofstest: snapshot of %s: %v", root, err)
+	}
+
+	rec := new(recorder)
+	view, err := rofs.NewFS(fsys, rofs.WithDebug(new(rofs.Debug)), rofs.WithObserver(rec))
+	if err != nil {
+		t.Fatalf("rofstest: %v", err)
+	}
+	fn(view)
+
+	if attempts := rec.list(); len(attempts) > 0 {
+		t.Errorf("rofstest: %d attempted writes:\n\t%s", len(attempts), strings.Join(attempts, "\n\t"))
+	}
+	after, err := snapshot(fsys, root)
+	if err != nil {
+		t.Fatalf("rofstest: snapshot of %s: %v", root, err)
+	}
+	if diff := compare(before, after); len(diff) > 0 {
+		t.Errorf("rofstest: %s changed:\n\t%s", root, strings.Join(diff, "\n\t"))
+	}
+}
+
+// recorder is an Observer keeping the operations refused by the view.
+type recorder struct {
+	mu       sync.Mutex
+	attempts []string
+}
+
+func (r *recorder) Before(*rofs.Event) {}
+
+func (r *recorder) After(e *rofs.Event) {
+	var se *rofs.StackError
+	if !errors.As(e.Err, &se) {
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s", e.Op, e.Path)
+	if e.Target != "" {
+		fmt.Fprintf(&b, " %s", e.Target)
+	}
+	if caller := se.Caller(); caller.Function != "" {
+		fmt.Fprintf(&b, " by %s at %s:%d", caller.Function, caller.File, caller.Line)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts = append(r.attempts, b.String())
+}
+
+func (r *recorder) list() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.attempts...)
+}
+
+// node is the state of a path in a snapshot.
+type node struct {
+	mode    fs.FileMode
+	size    int64
+	modTime int64 // in nanoseconds, for comparisons
+	sum     [sha256.Size]byte
+	link    string
+}
+
+func (n node) String() string {
+	switch {
+	case n.mode.IsDir():
+		return fmt.Sprintf("dir %v", n.mode)
+	case n.mode&fs.ModeSymlink != 0:
+		return "symlink to " + n.link
+	}
+	return fmt.Sprintf("%v, %d bytes, modified %s, sha256 %x", n.mode, n.size, time.Unix(0, n.modTime).UTC().Format(time.RFC3339Nano), n.sum[:6])
+}
+
+// snapshot records the state of every path below root.
+func snapshot(fsys absfs.SymlinkFileSystem, root string) (map[string]node, error) {
+	tree := make(map[string]node)
+	var walk func(name string) error
+	walk = func(name string) error {
+		info, err := fsys.Lstat(name)
+		if err != nil {
+			return err
+		}
+		n := node{mode: info.Mode()}
+		switch {
+		case info.IsDir():
+			entries, err := fsys.ReadDir(name)
+			if err != nil {
+				return err
+			}
+			for _, e := range entries {
+				if err := walk(path.Join(name, e.Name())); err != nil {
+					return err
+				}
+			}
+		case info.Mode()&fs.ModeSymlink != 0:
+			if n.link, err = fsys.Readlink(name); err != nil {
+				return err
+			}
+		default:
+			n.size, n.modTime = info.Size(), info.ModTime().UnixNano()
+			if info.Mode().IsRegular() {
+				f, err := fsys.Open(name)
+				if err != nil {
+					return err
+				}
+				h := sha256.New()
+				_, err = io.Copy(h, f)
+				f.Close()
+				if err != nil {
+					return err
+				}
+				copy(n.sum[:], h.Sum(nil))
+			}
+		}
+		tree[name] = n
+		return nil
+	}
+	return tree, walk(root)
+}
+
+// compare lists the differences between two snapshots.
+func compare(before, after map[string]node) []string {
+	var diff []string
+	for name, b := range before {
+		a, ok := after[name]
+		switch {
+		case !ok:
+			diff = append(diff, "removed "+name)
+		case a != b:
+			diff = append(diff, fmt.Sprintf("modified %s: %v, was %v", name, a, b))
+		}
+	}
+	for name := range after {
+		if _, ok := before[name]; !ok {
+			diff = append(diff, "added "+name)
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
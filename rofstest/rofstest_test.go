@@ -0,0 +1,101 @@
+package rofstest_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/ioutil"
+	"github.com/absfs/memfs"
+	"github.com/absfs/rofs/rofstest"
+)
+
+// fakeT records the failures reported to it.
+type fakeT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(format string, args ...any) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func (t *fakeT) Fatalf(format string, args ...any) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+	panic("Fatalf")
+}
+
+func newBackend(t *testing.T) absfs.SymlinkFileSystem {
+	t.Helper()
+	mfs, err := memfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mfs.MkdirAll("/etc/app", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(mfs, "/etc/app/config", []byte("debug = false\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return mfs
+}
+
+func writeDefaults(fsys absfs.FileSystem) {
+	ioutil.WriteFile(fsys, "/etc/app/config", []byte("debug = true\n"), 0644)
+}
+
+func TestAssertNoWrites(t *testing.T) {
+	backend := newBackend(t)
+
+	ft := &fakeT{TB: t}
+	rofstest.AssertNoWrites(ft, backend, func(fsys absfs.SymlinkFileSystem) {
+		if _, err := fsys.ReadFile("/etc/app/config"); err != nil {
+			t.Error(err)
+		}
+		if _, err := fsys.ReadDir("/etc"); err != nil {
+			t.Error(err)
+		}
+	})
+	if len(ft.errors) != 0 {
+		t.Errorf("reads reported as writes: %q", ft.errors)
+	}
+
+	ft = &fakeT{TB: t}
+	rofstest.AssertNoWrites(ft, backend, func(fsys absfs.SymlinkFileSystem) {
+		writeDefaults(fsys)
+		fsys.Rename("/etc/app/config", "/etc/app/config.bak")
+	})
+	if len(ft.errors) != 1 {
+		t.Fatalf("got %d failures, want 1: %q", len(ft.errors), ft.errors)
+	}
+	for _, want := range []string{
+		"2 attempted writes",
+		"open /etc/app/config by github.com/absfs/ioutil.WriteFile at ",
+		"rename /etc/app/config /etc/app/config.bak by github.com/absfs/rofs/rofstest_test.TestAssertNoWrites.func",
+	} {
+		if !strings.Contains(ft.errors[0], want) {
+			t.Errorf("failure lacks %q:\n%s", want, ft.errors[0])
+		}
+	}
+}
+
+func TestAssertNoWritesBypass(t *testing.T) {
+	backend := newBackend(t)
+	ft := &fakeT{TB: t}
+	rofstest.AssertNoWrites(ft, backend, func(absfs.SymlinkFileSystem) {
+		// a write that does not go through the view it was given
+		writeDefaults(backend)
+		backend.Mkdir("/etc/app/cache", 0755)
+	})
+	if len(ft.errors) != 1 {
+		t.Fatalf("got %d failures, want 1: %q", len(ft.errors), ft.errors)
+	}
+	for _, want := range []string{"added /etc/app/cache", "modified /etc/app/config"} {
+		if !strings.Contains(ft.errors[0], want) {
+			t.Errorf("failure lacks %q:\n%s", want, ft.errors[0])
+		}
+	}
+}
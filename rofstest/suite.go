@@ -0,0 +1,466 @@
+package rofstest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/memfs"
+)
+
+// A Factory wraps backend in the read-only filesystem under test.
+type Factory func(backend absfs.SymlinkFileSystem) (absfs.SymlinkFileSystem, error)
+
+// Suite checks that the filesystems made by factory honor the read-only
+// contract rofs implements, so that other absfs wrappers claiming read-only
+// semantics can be held to it as well. It wraps an in-memory backend holding
+// files, directories and symbolic links, and checks that:
+//
+//   - every mutating method, and OpenFile with every flag that could modify
+//     the backend, fails with an error matching fs.ErrPermission, of type
+//     *fs.PathError, or *os.LinkError for Rename and Symlink, and leaves the
+//     backend unchanged;
+//   - Write, WriteAt, WriteString and Truncate fail the same way on open
+//     files;
+//   - Stat, Lstat, ReadFile, ReadDir and reads through open files return
+//     what the backend returns, allowing for write permission bits to be
+//     masked;
+//   - Readdir, Readdirnames and ReadDir page through directories, returning
+//     at most n entries per call and io.EOF at the end;
+//   - symbolic links are reported by Lstat and Readlink and followed by Stat
+//     and Open, dangling links included, and cannot be written through.
+func Suite(t *testing.T, factory Factory) {
+	t.Helper()
+	backend, err := memfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"/data/file.txt":    "the quick brown fox\n",
+		"/data/empty":       "",
+		"/data/sub/a":       "a",
+		"/data/sub/b":       "bb",
+		"/data/sub/c":       "ccc",
+		"/data/sub/d":       "dddd",
+		"/data/sub/e":       "eeeee",
+		"/data/sub/deep/f":  "f",
+		"/data/other/g.txt": "g",
+	}
+	for name, content := range files {
+		if err := backend.MkdirAll(path.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		f, err := backend.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.WriteString(content); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"/data/link":     "file.txt",
+		"/data/dirlink":  "sub",
+		"/data/abs":      "/data/other/g.txt",
+		"/data/dangling": "nowhere",
+	}
+	for name, target := range links {
+		if err := backend.Symlink(target, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fsys, err := factory(backend)
+	if err != nil {
+		t.Fatalf("factory: %v", err)
+	}
+	before, err := snapshot(backend, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unchanged := func(t *testing.T) {
+		t.Helper()
+		after, err := snapshot(backend, "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := compare(before, after); len(diff) > 0 {
+			t.Fatalf("backend changed: %q", diff)
+		}
+	}
+
+	t.Run("Denied", func(t *testing.T) { suiteDenied(t, fsys, unchanged) })
+	t.Run("FileWritesDenied", func(t *testing.T) { suiteFileWrites(t, fsys, unchanged) })
+	t.Run("Reads", func(t *testing.T) { suiteReads(t, fsys, backend) })
+	t.Run("Pagination", func(t *testing.T) { suitePagination(t, fsys, backend) })
+	t.Run("Symlinks", func(t *testing.T) { suiteSymlinks(t, fsys, backend, unchanged) })
+}
+
+// denied checks that err is a refusal of the type the operation reports.
+func denied(t *testing.T, what string, err error, link bool) {
+	t.Helper()
+	if err == nil {
+		t.Errorf("%s succeeded", what)
+		return
+	}
+	if !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("%s: got %v, want an error matching fs.ErrPermission", what, err)
+	}
+	var pe *fs.PathError
+	var le *os.LinkError
+	switch {
+	case link && !errors.As(err, &le):
+		t.Errorf("%s: got %T, want *os.LinkError", what, err)
+	case !link && !errors.As(err, &pe):
+		t.Errorf("%s: got %T, want *fs.PathError", what, err)
+	}
+}
+
+func suiteDenied(t *testing.T, fsys absfs.SymlinkFileSystem, unchanged func(*testing.T)) {
+	now := time.Now()
+	ops := []struct {
+		name string
+		link bool
+		do   func() error
+	}{
+		{"Create", false, func() error { return closeIfOpen(fsys.Create("/data/new")) }},
+		{"Create existing", false, func() error { return closeIfOpen(fsys.Create("/data/file.txt")) }},
+		{"Mkdir", false, func() error { return fsys.Mkdir("/data/newdir", 0755) }},
+		{"MkdirAll", false, func() error { return fsys.MkdirAll("/data/new/nested", 0755) }},
+		{"Remove", false, func() error { return fsys.Remove("/data/file.txt") }},
+		{"Remove directory", false, func() error { return fsys.Remove("/data/other") }},
+		{"RemoveAll", false, func() error { return fsys.RemoveAll("/data") }},
+		{"Rename", true, func() error { return fsys.Rename("/data/file.txt", "/data/renamed") }},
+		{"Truncate", false, func() error { return fsys.Truncate("/data/file.txt", 0) }},
+		{"Chmod", false, func() error { return fsys.Chmod("/data/file.txt", 0600) }},
+		{"Chtimes", false, func() error { return fsys.Chtimes("/data/file.txt", now, now) }},
+		{"Chown", false, func() error { return fsys.Chown("/data/file.txt", 0, 0) }},
+		{"Lchown", false, func() error { return fsys.Lchown("/data/link", 0, 0) }},
+		{"Symlink", true, func() error { return fsys.Symlink("file.txt", "/data/newlink") }},
+	}
+	for _, op := range ops {
+		t.Run(op.name, func(t *testing.T) {
+			denied(t, op.name, op.do(), op.link)
+			unchanged(t)
+		})
+	}
+
+	flags := []struct {
+		name string
+		flag int
+	}{
+		{"O_WRONLY", os.O_WRONLY},
+		{"O_RDWR", os.O_RDWR},
+		{"O_RDONLY|O_CREATE", os.O_RDONLY | os.O_CREATE},
+		{"O_RDONLY|O_TRUNC", os.O_RDONLY | os.O_TRUNC},
+		{"O_RDONLY|O_APPEND", os.O_RDONLY | os.O_APPEND},
+		{"O_RDONLY|O_EXCL", os.O_RDONLY | os.O_EXCL},
+		{"O_WRONLY|O_APPEND", os.O_WRONLY | os.O_APPEND},
+		{"O_RDWR|O_CREATE|O_EXCL", os.O_RDWR | os.O_CREATE | os.O_EXCL},
+		{"O_WRONLY|O_CREATE|O_TRUNC", os.O_WRONLY | os.O_CREATE | os.O_TRUNC},
+	}
+	for _, fl := range flags {
+		for _, name := range []string{"/data/file.txt", "/data/missing"} {
+			t.Run("OpenFile "+fl.name+" "+name, func(t *testing.T) {
+				denied(t, "OpenFile", closeIfOpen(fsys.OpenFile(name, fl.flag, 0644)), false)
+				unchanged(t)
+			})
+		}
+	}
+}
+
+// closeIfOpen closes f if OpenFile unexpectedly succeeded and returns err.
+func closeIfOpen(f absfs.File, err error) error {
+	if err == nil && f != nil {
+		f.Close()
+	}
+	return err
+}
+
+func suiteFileWrites(t *testing.T, fsys absfs.SymlinkFileSystem, unchanged func(*testing.T)) {
+	f, err := fsys.Open("/data/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	_, err = f.Write([]byte("x"))
+	denied(t, "Write", err, false)
+	_, err = f.WriteAt([]byte("x"), 0)
+	denied(t, "WriteAt", err, false)
+	_, err = f.WriteString("x")
+	denied(t, "WriteString", err, false)
+	denied(t, "Truncate", f.Truncate(0), false)
+	unchanged(t)
+
+	d, err := fsys.Open("/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	_, err = d.Write([]byte("x"))
+	denied(t, "Write on a directory", err, false)
+	unchanged(t)
+}
+
+// sameInfo checks that got describes the same file as want, allowing for
+// masked write permission bits.
+func sameInfo(t *testing.T, what string, got, want fs.FileInfo) {
+	t.Helper()
+	if got.Name() != want.Name() || got.IsDir() != want.IsDir() ||
+		got.Mode().Type() != want.Mode().Type() ||
+		got.Mode().Perm()&^0222 != want.Mode().Perm()&^0222 ||
+		!got.ModTime().Equal(want.ModTime()) ||
+		(!want.IsDir() && got.Size() != want.Size()) {
+		t.Errorf("%s: got %s %v %d %v, want %s %v %d %v", what,
+			got.Name(), got.Mode(), got.Size(), got.ModTime(),
+			want.Name(), want.Mode(), want.Size(), want.ModTime())
+	}
+}
+
+func suiteReads(t *testing.T, fsys, backend absfs.SymlinkFileSystem) {
+	var walk func(dir string)
+	walk = func(dir string) {
+		want, err := backend.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := fsys.ReadDir(dir)
+		if err != nil {
+			t.Errorf("ReadDir %s: %v", dir, err)
+			return
+		}
+		if g, w := entryNames(got), entryNames(want); !reflect.DeepEqual(g, w) {
+			t.Errorf("ReadDir %s: got %v, want %v", dir, g, w)
+		}
+		for _, e := range want {
+			name := path.Join(dir, e.Name())
+			winfo, err := backend.Lstat(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ginfo, err := fsys.Lstat(name)
+			if err != nil {
+				t.Errorf("Lstat %s: %v", name, err)
+				continue
+			}
+			sameInfo(t, "Lstat "+name, ginfo, winfo)
+			switch {
+			case winfo.IsDir():
+				walk(name)
+			case winfo.Mode().IsRegular():
+				suiteReadFile(t, fsys, backend, name)
+			}
+		}
+	}
+	walk("/")
+}
+
+func suiteReadFile(t *testing.T, fsys, backend absfs.SymlinkFileSystem, name string) {
+	t.Helper()
+	want, err := backend.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := fsys.ReadFile(name); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("ReadFile %s: got %q, %v, want %q", name, got, err, want)
+	}
+	winfo, err := backend.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ginfo, err := fsys.Stat(name); err != nil {
+		t.Errorf("Stat %s: %v", name, err)
+	} else {
+		sameInfo(t, "Stat "+name, ginfo, winfo)
+	}
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		t.Errorf("Open %s: %v", name, err)
+		return
+	}
+	defer f.Close()
+	if got, err := io.ReadAll(f); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("reading %s: got %q, %v, want %q", name, got, err, want)
+	}
+	if info, err := f.Stat(); err != nil {
+		t.Errorf("File.Stat %s: %v", name, err)
+	} else {
+		sameInfo(t, "File.Stat "+name, info, winfo)
+	}
+	if len(want) > 1 {
+		buf := make([]byte, len(want)-1)
+		if n, err := f.ReadAt(buf, 1); n != len(buf) || (err != nil && err != io.EOF) || !bytes.Equal(buf, want[1:]) {
+			t.Errorf("ReadAt %s: got %q, %d, %v, want %q", name, buf[:n], n, err, want[1:])
+		}
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Errorf("Seek %s: %v", name, err)
+	} else if got, err := io.ReadAll(f); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("reading %s after Seek: got %q, %v, want %q", name, got, err, want)
+	}
+}
+
+func entryNames(entries []fs.DirEntry) []string {
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+	sort.Strings(names)
+	return names
+}
+
+func suitePagination(t *testing.T, fsys, backend absfs.SymlinkFileSystem) {
+	entries, err := backend.ReadDir("/data/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := entryNames(entries)
+
+	readers := []struct {
+		name string
+		read func(f absfs.File, n int) ([]string, error)
+	}{
+		{"Readdir", func(f absfs.File, n int) ([]string, error) {
+			infos, err := f.Readdir(n)
+			names := make([]string, len(infos))
+			for i, info := range infos {
+				names[i] = info.Name()
+			}
+			return names, err
+		}},
+		{"Readdirnames", func(f absfs.File, n int) ([]string, error) {
+			return f.Readdirnames(n)
+		}},
+		{"ReadDir", func(f absfs.File, n int) ([]string, error) {
+			entries, err := f.ReadDir(n)
+			names := make([]string, len(entries))
+			for i, e := range entries {
+				names[i] = e.Name()
+			}
+			return names, err
+		}},
+	}
+	for _, r := range readers {
+		for _, n := range []int{1, 2, 4, len(want), len(want) + 1} {
+			f, err := fsys.Open("/data/sub")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for calls := 0; ; calls++ {
+				if calls > len(want)+1 {
+					t.Errorf("%s(%d): no io.EOF after %d calls", r.name, n, calls)
+					break
+				}
+				page, err := r.read(f, n)
+				if len(page) > n {
+					t.Errorf("%s(%d): got %d entries", r.name, n, len(page))
+				}
+				got = append(got, page...)
+				if err == io.EOF {
+					if len(page) != 0 {
+						t.Errorf("%s(%d): io.EOF returned with %d entries", r.name, n, len(page))
+					}
+					break
+				}
+				if err != nil {
+					t.Errorf("%s(%d): %v", r.name, n, err)
+					break
+				}
+				if len(page) == 0 {
+					t.Errorf("%s(%d): no entries and no error", r.name, n)
+					break
+				}
+			}
+			f.Close()
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s(%d): got %v, want %v", r.name, n, got, want)
+			}
+		}
+
+		f, err := fsys.Open("/data/sub")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := r.read(f, -1)
+		f.Close()
+		sort.Strings(got)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s(-1): got %v, %v, want %v", r.name, got, err, want)
+		}
+	}
+}
+
+func suiteSymlinks(t *testing.T, fsys, backend absfs.SymlinkFileSystem, unchanged func(*testing.T)) {
+	for name, target := range map[string]string{
+		"/data/link":     "file.txt",
+		"/data/dirlink":  "sub",
+		"/data/abs":      "/data/other/g.txt",
+		"/data/dangling": "nowhere",
+	} {
+		info, err := fsys.Lstat(name)
+		if err != nil || info.Mode()&fs.ModeSymlink == 0 {
+			t.Errorf("Lstat %s: got %v, %v, want a symbolic link", name, info, err)
+		}
+		if got, err := fsys.Readlink(name); err != nil || got != target {
+			t.Errorf("Readlink %s: got %q, %v, want %q", name, got, err, target)
+		}
+	}
+
+	for link, target := range map[string]string{
+		"/data/link": "/data/file.txt",
+		"/data/abs":  "/data/other/g.txt",
+	} {
+		want, err := backend.Stat(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := fsys.Stat(link); err != nil {
+			t.Errorf("Stat %s: %v", link, err)
+		} else if got.Mode().Type() != want.Mode().Type() || got.Size() != want.Size() {
+			t.Errorf("Stat %s: got %v %d, want %v %d", link, got.Mode(), got.Size(), want.Mode(), want.Size())
+		}
+		content, err := backend.ReadFile(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := fsys.ReadFile(link); err != nil || !bytes.Equal(got, content) {
+			t.Errorf("ReadFile %s: got %q, %v, want %q", link, got, err, content)
+		}
+		denied(t, "OpenFile O_WRONLY through "+link, closeIfOpen(fsys.OpenFile(link, os.O_WRONLY, 0)), false)
+		denied(t, "Truncate through "+link, fsys.Truncate(link, 0), false)
+		denied(t, "Chmod through "+link, fsys.Chmod(link, 0600), false)
+	}
+
+	if info, err := fsys.Stat("/data/dirlink"); err != nil || !info.IsDir() {
+		t.Errorf("Stat /data/dirlink: got %v, %v, want a directory", info, err)
+	}
+	if entries, err := fsys.ReadDir("/data/dirlink"); err != nil || len(entries) == 0 {
+		t.Errorf("ReadDir /data/dirlink: got %d entries, %v", len(entries), err)
+	}
+	// whether links are followed in the middle of a path is up to the
+	// backend, so the wrapper only has to agree with it
+	want, werr := backend.ReadFile("/data/dirlink/a")
+	if got, err := fsys.ReadFile("/data/dirlink/a"); (err == nil) != (werr == nil) || !bytes.Equal(got, want) {
+		t.Errorf("ReadFile /data/dirlink/a: got %q, %v, want %q, %v", got, err, want, werr)
+	}
+	if _, err := fsys.Stat("/data/dangling"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat /data/dangling: got %v, want fs.ErrNotExist", err)
+	}
+	denied(t, "OpenFile O_CREATE through /data/dangling", closeIfOpen(fsys.OpenFile("/data/dangling", os.O_WRONLY|os.O_CREATE, 0644)), false)
+	denied(t, "Remove /data/link", fsys.Remove("/data/link"), false)
+	unchanged(t)
+}
@@ -0,0 +1,25 @@
+package rofstest_test
+
+import (
+	"testing"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/rofs"
+	"github.com/absfs/rofs/rofstest"
+)
+
+func TestSuite(t *testing.T) {
+	rofstest.Suite(t, func(backend absfs.SymlinkFileSystem) (absfs.SymlinkFileSystem, error) {
+		return rofs.NewFS(backend)
+	})
+}
+
+func TestSuiteSubFS(t *testing.T) {
+	rofstest.Suite(t, func(backend absfs.SymlinkFileSystem) (absfs.SymlinkFileSystem, error) {
+		rfs, err := rofs.NewFS(backend)
+		if err != nil {
+			return nil, err
+		}
+		return rfs.SubFS("/", rofs.WithRules(rofs.Deny("/nothing/**")))
+	})
+}
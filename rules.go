@@ -0,0 +1,183 @@
+package rofs
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// A Rule shows or hides the paths that match Pattern. Rules are evaluated in
+// order and the last rule that matches a path decides whether it is visible;
+// paths no rule matches are visible.
+//
+// Patterns are slash separated and anchored at the root of the view the rules
+// were given to. Each element is matched with path.Match, and an element of
+// "**" matches any number of path elements, including none, except at the
+// end of a pattern where it matches one or more: ".git/**" matches everything
+// inside .git but not .git itself. A pattern ending in "/" matches the named
+// path and everything below it, so "secrets/" is shorthand for the pair
+// "secrets" and "secrets/**".
+//
+// A path is hidden if it, or any directory above it, is hidden. An allowlist
+// therefore has to allow the directories leading to the files it exposes, for
+// example Deny("**") followed by Allow("docs/").
+type Rule struct {
+	Pattern string
+	Allow   bool
+}
+
+// Allow returns a Rule that makes the paths matching pattern visible.
+func Allow(pattern string) Rule {
+	return Rule{Pattern: pattern, Allow: true}
+}
+
+// Deny returns a Rule that hides the paths matching pattern.
+func Deny(pattern string) Rule {
+	return Rule{Pattern: pattern}
+}
+
+// WithRules adds rules that hide paths from the view. Hidden paths are left out
+// of directory listings, and opening, stating or reading them fails with
+// fs.ErrNotExist. Symbolic links are followed before the rules are applied,
+// whatever the symlink policy, so that a link cannot expose a hidden path.
+// Rules given to SubFS are anchored at the root of the new
+// view and are applied in addition to the rules inherited from its parent.
+func WithRules(rules ...Rule) Option {
+	return func(o *options) {
+		o.pending = append(o.pending, rules...)
+	}
+}
+
+// compiledRule is a Rule with its pattern split into elements.
+type compiledRule struct {
+	elems []string
+	allow bool
+}
+
+// ruleSet is a list of rules anchored at a directory of the wrapped
+// filesystem.
+type ruleSet struct {
+	base  string
+	rules []compiledRule
+}
+
+func compileRules(base string, rules []Rule) (ruleSet, error) {
+	set := ruleSet{base: base}
+	for _, r := range rules {
+		pattern := strings.TrimPrefix(r.Pattern, "/")
+		dir := strings.HasSuffix(pattern, "/")
+		elems := split(pattern)
+		for _, elem := range elems {
+			if _, err := path.Match(elem, ""); err != nil {
+				return ruleSet{}, &fs.PathError{Op: "rule", Path: r.Pattern, Err: err}
+			}
+		}
+		set.rules = append(set.rules, compiledRule{elems, r.Allow})
+		if dir {
+			set.rules = append(set.rules, compiledRule{append(elems, "**"), r.Allow})
+		}
+	}
+	return set, nil
+}
+
+// hides reports whether the set hides the path with the given elements,
+// judged on its own without regard to the directories above it.
+func (s *ruleSet) hides(elems []string) bool {
+	hidden := false
+	for _, r := range s.rules {
+		if match(r.elems, elems) {
+			hidden = !r.allow
+		}
+	}
+	return hidden
+}
+
+// match reports whether the pattern elements match the path elements.
+func match(pattern, elems []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				// A trailing "**" matches what is inside a directory, not
+				// the directory itself.
+				return len(elems) > 0
+			}
+			for i := len(elems); i >= 0; i-- {
+				if match(pattern[1:], elems[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(elems) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], elems[0]); !ok {
+			return false
+		}
+		pattern, elems = pattern[1:], elems[1:]
+	}
+	return len(elems) == 0
+}
+
+// hidden reports whether real, a path on the wrapped filesystem, is hidden by
+// the rules of the view.
+func (f *FileSystem) hidden(real string) bool {
+	for i := range f.opts.rules {
+		set := &f.opts.rules[i]
+		var rel string
+		switch {
+		case set.base == "/":
+			rel = real
+		case real == set.base:
+			continue
+		case strings.HasPrefix(real, set.base+"/"):
+			rel = real[len(set.base):]
+		default:
+			continue
+		}
+		elems := split(rel)
+		for n := 1; n <= len(elems); n++ {
+			if set.hides(elems[:n]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// locate maps name to a path on the wrapped filesystem like lookup, and fails
+// with fs.ErrNotExist if either the requested or the resolved path is hidden.
+// Under SymlinkFollow, where lookup leaves links to the wrapped filesystem,
+// they are expanded by rofs to find the path the wrapped filesystem would
+// resolve name to.
+func (f *FileSystem) locate(op, name string, followLast bool) (string, error) {
+	real, err := f.lookup(op, name, followLast)
+	if err != nil || len(f.opts.rules) == 0 {
+		return real, err
+	}
+	resolved := real
+	if f.opts.symlinks == SymlinkFollow {
+		if resolved, err = f.expand(op, name, followLast); err != nil {
+			return "", err
+		}
+	}
+	if f.hidden(f.real(name)) || f.hidden(resolved) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return real, nil
+}
+
+// visible removes the hidden elements from a directory listing of dir, a
+// path on the wrapped filesystem.
+func visible[T any](f *FileSystem, dir string, list []T, name func(T) string) []T {
+	if len(f.opts.rules) == 0 {
+		return list
+	}
+	out := list[:0]
+	for _, v := range list {
+		if !f.hidden(path.Join(dir, name(v))) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,384 @@
+package rofs_test
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"testing"
+	"testing/fstest"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/memfs"
+	"github.com/absfs/osfs"
+	"github.com/absfs/rofs"
+)
+
+// setupRulesFS returns a memfs holding a small configuration tree.
+func setupRulesFS(t *testing.T) absfs.SymlinkFileSystem {
+	t.Helper()
+	wfs, err := memfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"/cfg/.git/objects", "/cfg/secrets/nested", "/cfg/app/tls", "/cfg/docs/api"} {
+		mustMkdirAll(t, wfs, dir)
+	}
+	for _, file := range []string{
+		"/cfg/app.yaml",
+		"/cfg/server.key",
+		"/cfg/.git/HEAD",
+		"/cfg/.git/objects/ab",
+		"/cfg/secrets/db.txt",
+		"/cfg/secrets/nested/token",
+		"/cfg/app/tls/cert.pem",
+		"/cfg/app/tls/cert.key",
+		"/cfg/docs/readme.md",
+		"/cfg/docs/api/index.md",
+	} {
+		mustWrite(t, wfs, file, file)
+	}
+	if err := wfs.Symlink("/cfg/secrets/db.txt", "/cfg/db-link"); err != nil {
+		t.Fatal(err)
+	}
+	return wfs
+}
+
+func TestRules(t *testing.T) {
+	wfs := setupRulesFS(t)
+
+	tests := []struct {
+		name    string
+		rules   []rofs.Rule
+		visible []string
+		hidden  []string
+	}{
+		{
+			name:    "no rules",
+			visible: []string{"/cfg/server.key", "/cfg/.git/HEAD", "/cfg/secrets/db.txt"},
+		},
+		{
+			name:    "double star suffix",
+			rules:   []rofs.Rule{rofs.Deny("cfg/**/*.key")},
+			visible: []string{"/cfg/app.yaml", "/cfg/app/tls/cert.pem"},
+			hidden:  []string{"/cfg/server.key", "/cfg/app/tls/cert.key"},
+		},
+		{
+			name:    "double star matches directories and contents",
+			rules:   []rofs.Rule{rofs.Deny("cfg/.git/**")},
+			visible: []string{"/cfg", "/cfg/.git"},
+			hidden:  []string{"/cfg/.git/HEAD", "/cfg/.git/objects", "/cfg/.git/objects/ab"},
+		},
+		{
+			name:    "trailing slash hides a subtree",
+			rules:   []rofs.Rule{rofs.Deny("cfg/secrets/")},
+			visible: []string{"/cfg", "/cfg/app.yaml"},
+			hidden:  []string{"/cfg/secrets", "/cfg/secrets/db.txt", "/cfg/secrets/nested/token"},
+		},
+		{
+			name:    "hidden directory hides contents",
+			rules:   []rofs.Rule{rofs.Deny("cfg/secrets")},
+			hidden:  []string{"/cfg/secrets", "/cfg/secrets/nested/token"},
+			visible: []string{"/cfg/docs/readme.md"},
+		},
+		{
+			name:    "last match wins",
+			rules:   []rofs.Rule{rofs.Deny("**/*.key"), rofs.Allow("cfg/app/**")},
+			visible: []string{"/cfg/app/tls/cert.key"},
+			hidden:  []string{"/cfg/server.key"},
+		},
+		{
+			name:    "allowlist",
+			rules:   []rofs.Rule{rofs.Deny("**"), rofs.Allow("cfg"), rofs.Allow("cfg/docs/")},
+			visible: []string{"/", "/cfg", "/cfg/docs", "/cfg/docs/api/index.md"},
+			hidden:  []string{"/cfg/app.yaml", "/cfg/secrets", "/cfg/.git/HEAD"},
+		},
+		{
+			name:    "leading slash is anchored at the root",
+			rules:   []rofs.Rule{rofs.Deny("/cfg/app.yaml")},
+			visible: []string{"/cfg/app"},
+			hidden:  []string{"/cfg/app.yaml"},
+		},
+		{
+			name:    "symlink into a hidden path",
+			rules:   []rofs.Rule{rofs.Deny("cfg/secrets/")},
+			hidden:  []string{"/cfg/db-link"},
+			visible: []string{"/cfg/app.yaml"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rfs, err := rofs.NewFS(wfs, rofs.WithRules(tt.rules...), rofs.WithSymlinkPolicy(rofs.SymlinkConfine))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range tt.visible {
+				if _, err := rfs.Stat(name); err != nil {
+					t.Errorf("Stat(%s): expected visible, got %v", name, err)
+				}
+			}
+			for _, name := range tt.hidden {
+				if _, err := rfs.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+					t.Errorf("Stat(%s): expected fs.ErrNotExist, got %v", name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRulesApplyToEveryOperation(t *testing.T) {
+	wfs := setupRulesFS(t)
+	rfs, err := rofs.NewFS(wfs, rofs.WithRules(rofs.Deny("**/*.key"), rofs.Deny("cfg/.git/**"), rofs.Deny("cfg/secrets/")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ops := map[string]func(name string) error{
+		"Open": func(name string) error {
+			f, err := rfs.Open(name)
+			if err == nil {
+				f.Close()
+			}
+			return err
+		},
+		"Stat":     func(name string) error { _, err := rfs.Stat(name); return err },
+		"Lstat":    func(name string) error { _, err := rfs.Lstat(name); return err },
+		"Readlink": func(name string) error { _, err := rfs.Readlink(name); return err },
+		"ReadFile": func(name string) error { _, err := rfs.ReadFile(name); return err },
+		"ReadDir":  func(name string) error { _, err := rfs.ReadDir(name); return err },
+		"Chdir":    func(name string) error { return rfs.Chdir(name) },
+		"SubFS":    func(name string) error { _, err := rfs.SubFS(name); return err },
+	}
+	for op, fn := range ops {
+		for _, name := range []string{"/cfg/server.key", "/cfg/secrets", "/cfg/.git/objects"} {
+			err := fn(name)
+			if !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("%s(%s): expected fs.ErrNotExist, got %v", op, name, err)
+			}
+			var pathErr *fs.PathError
+			if errors.As(err, &pathErr) && pathErr.Path != name {
+				t.Errorf("%s(%s): error reports path %q", op, name, pathErr.Path)
+			}
+		}
+	}
+	if err := rfs.Chdir("/cfg"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rfs.ReadFile("secrets/db.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("relative ReadFile: expected fs.ErrNotExist, got %v", err)
+	}
+
+	wantNames := []string{".git", "app", "app.yaml", "db-link", "docs"}
+
+	t.Run("FileSystem.ReadDir", func(t *testing.T) {
+		entries, err := rfs.ReadDir("/cfg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		assertNames(t, names, wantNames)
+	})
+
+	t.Run("Readdirnames", func(t *testing.T) {
+		d, err := rfs.Open("/cfg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer d.Close()
+		names, err := d.Readdirnames(-1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertNames(t, names, wantNames)
+	})
+
+	t.Run("Readdir", func(t *testing.T) {
+		d, err := rfs.Open("/cfg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer d.Close()
+		infos, err := d.Readdir(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+		assertNames(t, names, wantNames)
+	})
+
+	t.Run("File.ReadDir pages", func(t *testing.T) {
+		for _, n := range []int{1, 2, 3, 10} {
+			d, err := rfs.Open("/cfg")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for {
+				entries, err := d.ReadDir(n)
+				if len(entries) > n {
+					t.Errorf("ReadDir(%d): got %d entries", n, len(entries))
+				}
+				for _, e := range entries {
+					names = append(names, e.Name())
+				}
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(entries) == 0 {
+					t.Fatalf("ReadDir(%d): no entries and no error", n)
+				}
+			}
+			d.Close()
+			assertNames(t, names, wantNames)
+		}
+	})
+
+	t.Run("hidden subdirectory contents", func(t *testing.T) {
+		entries, err := rfs.ReadDir("/cfg/.git")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 0 {
+			t.Errorf("ReadDir(/cfg/.git): expected no entries, got %d", len(entries))
+		}
+	})
+
+	t.Run("io/fs", func(t *testing.T) {
+		// db-link points into the hidden secrets and cannot be opened, so
+		// the tree is tested from below /cfg.
+		fsys, err := rfs.Sub("/cfg/app")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fstest.TestFS(fsys, "tls/cert.pem"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fs.ReadFile(fsys, "tls/cert.key"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("ReadFile: expected fs.ErrNotExist, got %v", err)
+		}
+		cfg, err := rfs.Sub("/cfg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fs.ReadFile(cfg, "db-link"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("ReadFile(db-link): expected fs.ErrNotExist, got %v", err)
+		}
+	})
+}
+
+func TestRulesFollowLinks(t *testing.T) {
+	mfs, err := memfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ofs, err := osfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	backends := []struct {
+		name string
+		fs   absfs.SymlinkFileSystem
+		base string
+	}{
+		{"memfs", mfs, "/base"},
+		{"osfs", ofs, osfs.FromNative(t.TempDir())},
+	}
+
+	for _, b := range backends {
+		mustMkdirAll(t, b.fs, b.base+"/cfg/secrets")
+		mustWrite(t, b.fs, b.base+"/cfg/secrets/db.txt", "secret")
+		mustWrite(t, b.fs, b.base+"/cfg/app.yaml", "app")
+		links := map[string]string{
+			"/cfg/link":    b.base + "/cfg/secrets/db.txt",
+			"/cfg/rellink": "secrets/db.txt",
+			"/cfg/dirlink": "secrets",
+			"/cfg/ok":      "app.yaml",
+		}
+		for name, target := range links {
+			if err := b.fs.Symlink(target, b.base+name); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, policy := range []rofs.SymlinkPolicy{rofs.SymlinkFollow, rofs.SymlinkConfine} {
+			t.Run(b.name+"/"+policy.String(), func(t *testing.T) {
+				rfs, err := rofs.NewFS(b.fs, rofs.WithRules(rofs.Deny("**/secrets/")), rofs.WithSymlinkPolicy(policy))
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, name := range []string{"/cfg/link", "/cfg/rellink", "/cfg/dirlink/db.txt"} {
+					if data, err := rfs.ReadFile(b.base + name); !errors.Is(err, fs.ErrNotExist) {
+						t.Errorf("ReadFile(%s): expected fs.ErrNotExist, got %q, %v", name, data, err)
+					}
+					if _, err := rfs.Stat(b.base + name); !errors.Is(err, fs.ErrNotExist) {
+						t.Errorf("Stat(%s): expected fs.ErrNotExist, got %v", name, err)
+					}
+				}
+				if _, err := rfs.ReadDir(b.base + "/cfg/dirlink"); !errors.Is(err, fs.ErrNotExist) {
+					t.Errorf("ReadDir(/cfg/dirlink): expected fs.ErrNotExist, got %v", err)
+				}
+				if _, err := rfs.Lstat(b.base + "/cfg/link"); err != nil {
+					t.Errorf("Lstat(/cfg/link): the link itself should be visible: %v", err)
+				}
+				if data, err := rfs.ReadFile(b.base + "/cfg/ok"); err != nil || string(data) != "app" {
+					t.Errorf("ReadFile(/cfg/ok): got %q, %v", data, err)
+				}
+			})
+		}
+	}
+}
+
+func TestRulesOnSubFS(t *testing.T) {
+	wfs := setupRulesFS(t)
+	rfs, err := rofs.NewFS(wfs, rofs.WithRules(rofs.Deny("**/*.key")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := rfs.SubFS("/cfg", rofs.WithRules(rofs.Deny("secrets/")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"/server.key", "/app/tls/cert.key", "/secrets/db.txt"} {
+		if _, err := sub.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("sub Stat(%s): expected fs.ErrNotExist, got %v", name, err)
+		}
+	}
+	if _, err := sub.Stat(path.Join("/docs", "readme.md")); err != nil {
+		t.Errorf("sub Stat: unexpected error %v", err)
+	}
+	if _, err := rfs.Stat("/cfg/secrets/db.txt"); err != nil {
+		t.Errorf("parent Stat: sub rules leaked into parent: %v", err)
+	}
+}
+
+func TestRulesBadPattern(t *testing.T) {
+	wfs := setupRulesFS(t)
+	if _, err := rofs.NewFS(wfs, rofs.WithRules(rofs.Deny("cfg/[a"))); !errors.Is(err, path.ErrBadPattern) {
+		t.Errorf("NewFS: expected ErrBadPattern, got %v", err)
+	}
+}
+
+func assertNames(t *testing.T, got, want []string) {
+	t.Helper()
+	sort.Strings(got)
+	if len(got) != len(want) {
+		t.Fatalf("names: expected %v, got %v", want, got)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("names: expected %v, got %v", want, got)
+		}
+	}
+}
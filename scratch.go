@@ -0,0 +1,178 @@
+package rofs
+
+import (
+	"bytes"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+
+	"github.com/absfs/absfs"
+)
+
+// WithScratch gives the FileSystem an ephemeral upper layer. Every mutating
+// operation then succeeds, but its effect is kept in upper instead of the
+// wrapped filesystem, which is never modified: files are copied up into
+// upper before they are changed, directory listings merge both layers, and
+// removed files are hidden by whiteouts kept in memory. Reads see the merged
+// result. Use Changes to list what was modified and Discard to start over.
+//
+// upper must be empty, for example a new memfs, and is owned by the
+// FileSystem from then on: Discard removes everything it holds. NewFS fails
+// with an error matching syscall.ENOTEMPTY if upper is not empty. WithScratch
+// only takes effect in NewFS; views derived with SubFS share the scratch
+// layer of their parent.
+func WithScratch(upper absfs.SymlinkFileSystem) Option {
+	return func(o *options) {
+		o.scratch = upper
+	}
+}
+
+// ChangeKind tells how a path was changed in a scratch layer.
+type ChangeKind int
+
+const (
+	// ChangeAdded is a path that did not exist in the wrapped filesystem.
+	ChangeAdded ChangeKind = iota
+
+	// ChangeModified is a path whose content, mode or link target differs
+	// from the wrapped filesystem.
+	ChangeModified
+
+	// ChangeDeleted is a path of the wrapped filesystem that was removed.
+	ChangeDeleted
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeAdded:
+		return "added"
+	case ChangeModified:
+		return "modified"
+	case ChangeDeleted:
+		return "deleted"
+	}
+	return "ChangeKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// A Change is a path that differs between the scratch layer and the wrapped
+// filesystem.
+type Change struct {
+	Path string
+	Kind ChangeKind
+}
+
+// Changes returns the paths of the view that have been added, modified or
+// deleted in the scratch layer, sorted by path. Removed directories are
+// reported without their content. Changes returns nil if the FileSystem has
+// no scratch layer.
+func (f *FileSystem) Changes() []Change {
+	if f.ov == nil {
+		return nil
+	}
+	var out []Change
+	for _, c := range f.ov.changes() {
+		if c.Path != f.root && !inTree([]string{f.root}, c.Path) {
+			continue
+		}
+		c.Path = f.virtual(c.Path)
+		out = append(out, c)
+	}
+	return out
+}
+
+// Discard drops every change kept in the scratch layer, so that the view
+// shows the wrapped filesystem again. Files opened for writing before the
+// call must not be used afterwards. Discard does nothing if the FileSystem
+// has no scratch layer.
+func (f *FileSystem) Discard() error {
+	if f.ov == nil {
+		return nil
+	}
+	return f.ov.reset()
+}
+
+// changes implements FileSystem.Changes with paths of the wrapped
+// filesystem.
+func (o *overlay) changes() []Change {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	var out []Change
+	var walk func(p string)
+	walk = func(p string) {
+		info, err := o.upper.Lstat(p)
+		if err != nil {
+			return
+		}
+		if p != "/" {
+			if old, err := o.lower.Lstat(p); err != nil {
+				out = append(out, Change{Path: p, Kind: ChangeAdded})
+			} else if o.differs(p, old, info) {
+				out = append(out, Change{Path: p, Kind: ChangeModified})
+			}
+		}
+		if !info.IsDir() {
+			return
+		}
+		if o.opaque[p] && o.inLower(p) {
+			// entries of the lower directory the upper one replaced
+			if entries, err := o.lower.ReadDir(p); err == nil {
+				for _, e := range entries {
+					q := path.Join(p, e.Name())
+					if _, err := o.upper.Lstat(q); err != nil {
+						out = append(out, Change{Path: q, Kind: ChangeDeleted})
+					}
+				}
+			}
+		}
+		entries, err := o.upper.ReadDir(p)
+		if err != nil {
+			return
+		}
+		for _, e := range entries {
+			walk(path.Join(p, e.Name()))
+		}
+	}
+	walk("/")
+
+	for p := range o.deleted {
+		if _, err := o.upper.Lstat(p); err == nil {
+			continue // replaced, reported as added
+		}
+		if !o.lowerVisible(path.Dir(p)) {
+			continue // below a removed or replaced directory
+		}
+		if _, err := o.lower.Lstat(p); err == nil {
+			out = append(out, Change{Path: p, Kind: ChangeDeleted})
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+// differs reports whether p, present in both layers as old and cur, has been
+// changed in the upper layer.
+func (o *overlay) differs(p string, old, cur fs.FileInfo) bool {
+	if old.Mode().Type() != cur.Mode().Type() || old.Mode().Perm() != cur.Mode().Perm() {
+		return true
+	}
+	switch {
+	case cur.IsDir():
+		return false
+	case cur.Mode()&fs.ModeSymlink != 0:
+		a, _ := o.lower.Readlink(p)
+		b, _ := o.upper.Readlink(p)
+		return a != b
+	}
+	if old.Size() != cur.Size() {
+		return true
+	}
+	a, err := o.lower.ReadFile(p)
+	if err != nil {
+		return true
+	}
+	b, err := o.upper.ReadFile(p)
+	return err != nil || !bytes.Equal(a, b)
+}
@@ -0,0 +1,152 @@
+package rofs_test
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/absfs/ioutil"
+	"github.com/absfs/memfs"
+	"github.com/absfs/rofs"
+)
+
+func TestScratch(t *testing.T) {
+	for _, b := range testBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			dir := path.Join(b.dir, "scratch")
+			mustMkdirAll(t, b.fs, path.Join(dir, "data", "sub"))
+			mustWrite(t, b.fs, path.Join(dir, "data", "input.csv"), "a,b\n")
+			mustWrite(t, b.fs, path.Join(dir, "data", "sub", "x"), "x")
+			mustWrite(t, b.fs, path.Join(dir, "data", "sub", "y"), "y")
+			mustWrite(t, b.fs, path.Join(dir, "data", "stale.lock"), "1")
+			before := tree(t, b.fs, dir)
+
+			upper, err := memfs.NewFS()
+			if err != nil {
+				t.Fatal(err)
+			}
+			rfs, err := rofs.NewFS(b.fs, rofs.WithScratch(upper))
+			if err != nil {
+				t.Fatal(err)
+			}
+			view, err := rfs.SubFS(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// what a library writing next to its inputs would do
+			if err := ioutil.WriteFile(view, "/data/input.csv.lock", []byte("42"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := view.MkdirAll("/data/.cache/v1", 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(view, "/data/input.csv", []byte("a,b\n1,2\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := view.Remove("/data/stale.lock"); err != nil {
+				t.Fatal(err)
+			}
+			if err := view.RemoveAll("/data/sub"); err != nil {
+				t.Fatal(err)
+			}
+			if err := view.Mkdir("/data/sub", 0755); err != nil {
+				t.Fatal(err)
+			}
+			mustWrite(t, view, "/data/sub/y", "new y")
+			if err := view.Chmod("/data/.cache", 0700); err != nil {
+				t.Fatal(err)
+			}
+			if info, err := view.Stat("/data/.cache"); err != nil || !info.IsDir() || info.Mode().Perm() != 0700 {
+				t.Errorf("Stat after Chmod: %v, %v", info, err)
+			}
+
+			if got := tree(t, b.fs, dir); !reflect.DeepEqual(got, before) {
+				t.Errorf("lower layer changed:\nbefore %v\nafter  %v", before, got)
+			}
+
+			want := map[string]string{
+				"data":                "<dir>",
+				"data/.cache":         "<dir>",
+				"data/.cache/v1":      "<dir>",
+				"data/input.csv":      "a,b\n1,2\n",
+				"data/input.csv.lock": "42",
+				"data/sub":            "<dir>",
+				"data/sub/y":          "new y",
+			}
+			if got := tree(t, view, "/"); !reflect.DeepEqual(got, want) {
+				t.Errorf("merged view:\ngot  %v\nwant %v", got, want)
+			}
+			if _, err := view.Stat("/data/stale.lock"); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("Stat whited out file: got %v", err)
+			}
+
+			wantChanges := []rofs.Change{
+				{Path: "/data/.cache", Kind: rofs.ChangeAdded},
+				{Path: "/data/.cache/v1", Kind: rofs.ChangeAdded},
+				{Path: "/data/input.csv", Kind: rofs.ChangeModified},
+				{Path: "/data/input.csv.lock", Kind: rofs.ChangeAdded},
+				{Path: "/data/stale.lock", Kind: rofs.ChangeDeleted},
+				{Path: "/data/sub/x", Kind: rofs.ChangeDeleted},
+				{Path: "/data/sub/y", Kind: rofs.ChangeModified},
+			}
+			if got := view.Changes(); !reflect.DeepEqual(got, wantChanges) {
+				t.Errorf("Changes:\ngot  %v\nwant %v", got, wantChanges)
+			}
+			if got := rfs.Changes(); len(got) != len(wantChanges) || got[0].Path != path.Join(dir, "data/.cache") {
+				t.Errorf("Changes of the parent view: %v", got)
+			}
+
+			if err := view.Discard(); err != nil {
+				t.Fatal(err)
+			}
+			if got := view.Changes(); len(got) != 0 {
+				t.Errorf("Changes after Discard: %v", got)
+			}
+			if got := tree(t, view, "/"); !reflect.DeepEqual(got, before) {
+				t.Errorf("view after Discard:\ngot  %v\nwant %v", got, before)
+			}
+			if entries, err := upper.ReadDir("/"); err != nil || len(entries) != 0 {
+				t.Errorf("upper layer after Discard: %v, %v", entries, err)
+			}
+		})
+	}
+}
+
+func TestChangeKindString(t *testing.T) {
+	for k, want := range map[rofs.ChangeKind]string{
+		rofs.ChangeAdded:    "added",
+		rofs.ChangeModified: "modified",
+		rofs.ChangeDeleted:  "deleted",
+		rofs.ChangeKind(9):  "ChangeKind(9)",
+	} {
+		if got := k.String(); got != want {
+			t.Errorf("%d: got %q, want %q", k, got, want)
+		}
+	}
+}
+
+func TestScratchRejectsNonEmptyUpper(t *testing.T) {
+	lower, err := memfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	upper, err := memfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, upper, "/keep.txt", "not ours")
+
+	if _, err := rofs.NewFS(lower, rofs.WithScratch(upper)); !errors.Is(err, syscall.ENOTEMPTY) {
+		t.Errorf("NewFS: got %v, want ENOTEMPTY", err)
+	}
+	if _, err := rofs.NewDryRun(lower, rofs.WithScratch(upper)); !errors.Is(err, syscall.ENOTEMPTY) {
+		t.Errorf("NewDryRun: got %v, want ENOTEMPTY", err)
+	}
+	if data, err := ioutil.ReadFile(upper, "/keep.txt"); err != nil || string(data) != "not ours" {
+		t.Errorf("upper changed: %q, %v", data, err)
+	}
+}
@@ -0,0 +1,141 @@
+package rofs
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/fs"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/absfs/absfs"
+)
+
+// WithSealOnClose makes every file opened for writing through the view
+// immutable once the File it was opened with is closed. After that, opening
+// the path for writing, truncating, changing its mode, owner or times,
+// renaming and removing it fail with ErrReadOnly, as do removing or renaming
+// a directory that contains it. Files never written through the view are
+// not affected.
+//
+// The sealed paths are recorded in the index file at index, anchored at the
+// root of the view like the directories given to WithWritable, so that they
+// stay sealed when the filesystem is wrapped again after a restart. The index
+// is kept on the wrapped filesystem and cannot be modified through the view,
+// nor can the directories above it be removed or renamed.
+// Views derived with SubFS share the index of their parent.
+func WithSealOnClose(index string) Option {
+	return func(o *options) {
+		o.pendingSeal = index
+	}
+}
+
+// sealIndex is the set of sealed paths of the wrapped filesystem, together
+// with the file it is persisted in.
+type sealIndex struct {
+	name string // path of the index on the wrapped filesystem
+
+	once    sync.Once
+	loadErr error
+
+	mu     sync.RWMutex
+	sealed map[string]bool
+}
+
+// load reads the index from backend the first time it is called.
+func (s *sealIndex) load(backend absfs.SymlinkFileSystem) error {
+	s.once.Do(func() {
+		s.sealed = make(map[string]bool)
+		data, err := backend.ReadFile(s.name)
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				s.loadErr = err
+			}
+			return
+		}
+		sc := bufio.NewScanner(bytes.NewReader(data))
+		for sc.Scan() {
+			line := strings.TrimSpace(sc.Text())
+			if line == "" {
+				continue
+			}
+			name, err := strconv.Unquote(line)
+			if err != nil {
+				s.loadErr = err
+				return
+			}
+			s.sealed[name] = true
+		}
+		s.loadErr = sc.Err()
+	})
+	return s.loadErr
+}
+
+// contains reports whether real is sealed or, with deep set, whether a path
+// below it is.
+func (s *sealIndex) contains(real string, deep bool) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.sealed[real] {
+		return true
+	}
+	if deep {
+		prefix := real + "/"
+		if real == "/" {
+			prefix = "/"
+		}
+		for name := range s.sealed {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// seal adds real to the index and appends it to the index file.
+func (s *sealIndex) seal(backend absfs.SymlinkFileSystem, real string) error {
+	if err := s.load(backend); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sealed[real] {
+		return nil
+	}
+	f, err := backend.OpenFile(s.name, absfs.O_WRONLY|absfs.O_CREATE|absfs.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(strconv.Quote(real) + "\n")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	s.sealed[real] = true
+	return nil
+}
+
+// checkSealed returns the error to report if op may not be applied to the
+// file at real because it, or for op "rename" and "removeall" anything
+// below it, has been sealed or is the index.
+func (f *FileSystem) checkSealed(op, name, real string) error {
+	s := f.opts.seal
+	if s == nil {
+		return nil
+	}
+	deep := op == "rename" || op == "removeall"
+	if real == s.name || deep && (real == "/" || strings.HasPrefix(s.name, real+"/")) {
+		return readOnly(op, name)
+	}
+	if err := s.load(f.fs); err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	if s.contains(real, deep) {
+		return readOnly(op, name)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package rofs_test
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/absfs/ioutil"
+	"github.com/absfs/memfs"
+	"github.com/absfs/rofs"
+)
+
+func TestSealOnClose(t *testing.T) {
+	for _, b := range testBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			dir := path.Join(b.dir, "artifacts")
+			mustMkdirAll(t, b.fs, path.Join(dir, "build"))
+
+			open := func(t *testing.T) *rofs.FileSystem {
+				t.Helper()
+				rfs, err := rofs.NewFS(b.fs)
+				if err != nil {
+					t.Fatal(err)
+				}
+				view, err := rfs.SubFS(dir, rofs.WithWritable("/"), rofs.WithSealOnClose(".sealed"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return view
+			}
+			denied := func(t *testing.T, what string, err error) {
+				t.Helper()
+				if !errors.Is(err, rofs.ErrReadOnly) {
+					t.Errorf("%s: got %v, want ErrReadOnly", what, err)
+				}
+			}
+
+			view := open(t)
+			f, err := view.Create("/build/app.bin")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.WriteString("binary"); err != nil {
+				t.Fatal(err)
+			}
+			// the file can be written until it is closed
+			if _, err := f.WriteAt([]byte("B"), 0); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			check := func(t *testing.T, view *rofs.FileSystem) {
+				_, err := view.OpenFile("/build/app.bin", os.O_WRONLY, 0)
+				denied(t, "OpenFile", err)
+				_, err = view.Create("/build/app.bin")
+				denied(t, "Create", err)
+				denied(t, "Truncate", view.Truncate("/build/app.bin", 0))
+				denied(t, "Chmod", view.Chmod("/build/app.bin", 0600))
+				denied(t, "Remove", view.Remove("/build/app.bin"))
+				denied(t, "RemoveAll", view.RemoveAll("/build"))
+				denied(t, "Rename", view.Rename("/build/app.bin", "/app.bin"))
+				denied(t, "Rename dir", view.Rename("/build", "/dist"))
+				denied(t, "Rename over", view.Rename("/other", "/build/app.bin"))
+				denied(t, "write index", ioutil.WriteFile(view, "/.sealed", nil, 0644))
+				denied(t, "remove index", view.Remove("/.sealed"))
+
+				if data, err := view.ReadFile("/build/app.bin"); err != nil || string(data) != "Binary" {
+					t.Errorf("ReadFile: got %q, %v", data, err)
+				}
+			}
+
+			mustWrite(t, b.fs, path.Join(dir, "other"), "other")
+			check(t, view)
+
+			// files that were never written through the view stay writable
+			if err := ioutil.WriteFile(view, "/other", []byte("changed"), 0644); err != nil {
+				t.Errorf("unsealed file: %v", err)
+			}
+
+			t.Run("survives restart", func(t *testing.T) {
+				restarted := open(t)
+				check(t, restarted)
+
+				sub, err := restarted.SubFS("/build")
+				if err != nil {
+					t.Fatal(err)
+				}
+				denied(t, "Remove through SubFS", sub.Remove("/app.bin"))
+			})
+		})
+	}
+}
+
+func TestSealIndexParent(t *testing.T) {
+	for _, b := range testBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			dir := path.Join(b.dir, "sealindex")
+			mustMkdirAll(t, b.fs, path.Join(dir, "meta"))
+			mustMkdirAll(t, b.fs, path.Join(dir, "build"))
+
+			rfs, err := rofs.NewFS(b.fs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			view, err := rfs.SubFS(dir, rofs.WithWritable("/"), rofs.WithSealOnClose("meta/.sealed"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(view, "/build/app.bin", []byte("binary"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			index := path.Join(dir, "meta", ".sealed")
+			want, err := ioutil.ReadFile(b.fs, index)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, tt := range []struct {
+				name string
+				err  error
+			}{
+				{"RemoveAll parent", view.RemoveAll("/meta")},
+				{"RemoveAll root", view.RemoveAll("/")},
+				{"Rename parent", view.Rename("/meta", "/moved")},
+			} {
+				if !errors.Is(tt.err, rofs.ErrReadOnly) {
+					t.Errorf("%s: got %v, want ErrReadOnly", tt.name, tt.err)
+				}
+			}
+			if data, err := ioutil.ReadFile(b.fs, index); err != nil || string(data) != string(want) {
+				t.Errorf("index changed: got %q, %v", data, err)
+			}
+		})
+	}
+}
+
+func TestSealThroughSymlink(t *testing.T) {
+	mfs, err := memfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sw, err := rofs.NewSwitch(mfs, rofs.WithSealOnClose("/.seal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(sw, "/art", []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := sw.Symlink("/art", "/l"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sw.OpenFile("/l", os.O_WRONLY|os.O_TRUNC, 0); !errors.Is(err, rofs.ErrReadOnly) {
+		t.Errorf("OpenFile through a link: got %v, want ErrReadOnly", err)
+	}
+	if err := sw.Truncate("/l", 0); !errors.Is(err, rofs.ErrReadOnly) {
+		t.Errorf("Truncate through a link: got %v, want ErrReadOnly", err)
+	}
+	if err := sw.Chmod("/l", 0600); !errors.Is(err, rofs.ErrReadOnly) {
+		t.Errorf("Chmod through a link: got %v, want ErrReadOnly", err)
+	}
+	if data, err := ioutil.ReadFile(mfs, "/art"); err != nil || string(data) != "v1" {
+		t.Errorf("sealed file = %q, %v", data, err)
+	}
+}
@@ -0,0 +1,208 @@
+package rofs_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/memfs"
+	"github.com/absfs/rofs"
+)
+
+func TestSubFS(t *testing.T) {
+	rfs, _ := setupTestFS(t)
+
+	sub, err := rfs.SubFS("/testdir")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("implements SymlinkFileSystem", func(t *testing.T) {
+		var _ absfs.SymlinkFileSystem = sub
+	})
+
+	t.Run("starts at its own root", func(t *testing.T) {
+		wd, err := sub.Getwd()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wd != "/" {
+			t.Errorf("Getwd: expected '/', got %q", wd)
+		}
+	})
+
+	t.Run("reads files relative to the new root", func(t *testing.T) {
+		data, err := sub.ReadFile("/file.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "test content" {
+			t.Errorf("ReadFile: expected 'test content', got %q", data)
+		}
+
+		data, err = sub.ReadFile("subdir/nested.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "nested content" {
+			t.Errorf("ReadFile: expected 'nested content', got %q", data)
+		}
+	})
+
+	t.Run("dot-dot cannot escape the root", func(t *testing.T) {
+		for _, name := range []string{"/../empty.txt", "../empty.txt", "subdir/../../empty.txt", "/../../../empty.txt"} {
+			if _, err := sub.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("Stat(%q): expected fs.ErrNotExist, got %v", name, err)
+			}
+		}
+
+		data, err := sub.ReadFile("/../file.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "test content" {
+			t.Errorf("ReadFile(/../file.txt): expected 'test content', got %q", data)
+		}
+	})
+
+	t.Run("File.Name is relative to the new root", func(t *testing.T) {
+		f, err := sub.Open("subdir/nested.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if f.Name() != "/subdir/nested.txt" {
+			t.Errorf("Name: expected '/subdir/nested.txt', got %q", f.Name())
+		}
+	})
+
+	t.Run("errors report paths relative to the new root", func(t *testing.T) {
+		_, err := sub.Open("/missing.txt")
+		var pathErr *os.PathError
+		if !errors.As(err, &pathErr) {
+			t.Fatalf("expected *os.PathError, got %T %v", err, err)
+		}
+		if pathErr.Path != "/missing.txt" {
+			t.Errorf("PathError.Path: expected '/missing.txt', got %q", pathErr.Path)
+		}
+	})
+
+	t.Run("Lstat and Readlink are available", func(t *testing.T) {
+		info, err := sub.Lstat("/link.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			t.Errorf("Lstat: expected symlink mode, got %s", info.Mode())
+		}
+		if _, err := sub.Readlink("/link.txt"); err != nil {
+			t.Errorf("Readlink: unexpected error %v", err)
+		}
+	})
+
+	t.Run("remains read-only", func(t *testing.T) {
+		if err := sub.Mkdir("/newdir", 0755); !errors.Is(err, rofs.ErrReadOnly) {
+			t.Errorf("Mkdir: expected ErrReadOnly, got %v", err)
+		}
+		if _, err := sub.OpenFile("/file.txt", os.O_RDWR, 0); !errors.Is(err, rofs.ErrReadOnly) {
+			t.Errorf("OpenFile: expected ErrReadOnly, got %v", err)
+		}
+	})
+
+	t.Run("Chdir stays within the view", func(t *testing.T) {
+		sub, err := rfs.SubFS("/testdir")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sub.Chdir("subdir"); err != nil {
+			t.Fatal(err)
+		}
+		wd, _ := sub.Getwd()
+		if wd != "/subdir" {
+			t.Errorf("Getwd: expected '/subdir', got %q", wd)
+		}
+		if _, err := sub.Stat("nested.txt"); err != nil {
+			t.Errorf("Stat nested.txt: unexpected error %v", err)
+		}
+		if err := sub.Chdir("../.."); err != nil {
+			t.Fatal(err)
+		}
+		wd, _ = sub.Getwd()
+		if wd != "/" {
+			t.Errorf("Getwd: expected '/', got %q", wd)
+		}
+	})
+
+	t.Run("nested SubFS", func(t *testing.T) {
+		nested, err := sub.SubFS("subdir")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := nested.ReadFile("/nested.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "nested content" {
+			t.Errorf("ReadFile: expected 'nested content', got %q", data)
+		}
+		if _, err := nested.Stat("/../file.txt"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Stat(/../file.txt): expected fs.ErrNotExist, got %v", err)
+		}
+	})
+
+	t.Run("SubFS of a file fails", func(t *testing.T) {
+		if _, err := rfs.SubFS("/testdir/file.txt"); err == nil {
+			t.Error("expected error, got nil")
+		}
+		if _, err := rfs.SubFS("/missing"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected fs.ErrNotExist, got %v", err)
+		}
+	})
+
+	t.Run("Sub returns an fs.FS over the subtree", func(t *testing.T) {
+		fsys, err := rfs.Sub("/testdir")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := fs.ReadFile(fsys, "subdir/nested.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "nested content" {
+			t.Errorf("ReadFile: expected 'nested content', got %q", data)
+		}
+	})
+}
+
+func TestSubFSTempDir(t *testing.T) {
+	mfs, err := memfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mfs.Tempdir = "/var/tmp"
+	mustMkdirAll(t, mfs, "/var/tmp")
+	mustMkdirAll(t, mfs, "/a")
+	rfs, err := rofs.NewFS(mfs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		dir, want string
+	}{
+		{"/", "/var/tmp"},
+		{"/var", "/tmp"},
+		{"/var/tmp", "/"},
+		{"/a", ""},
+	} {
+		sub, err := rfs.SubFS(tt.dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := sub.TempDir(); got != tt.want {
+			t.Errorf("SubFS(%s).TempDir() = %q, want %q", tt.dir, got, tt.want)
+		}
+	}
+}
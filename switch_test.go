@@ -0,0 +1,164 @@
+package rofs_test
+
+import (
+	"context"
+	"errors"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/absfs/ioutil"
+	"github.com/absfs/memfs"
+	"github.com/absfs/rofs"
+)
+
+func TestSwitch(t *testing.T) {
+	for _, b := range testBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			dir := path.Join(b.dir, "switch")
+			mustMkdirAll(t, b.fs, dir)
+
+			sw, err := rofs.NewSwitch(b.fs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			view, err := sw.SubFS(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sw.Locked() {
+				t.Fatal("new switch is locked")
+			}
+
+			// unlocked: writes are forwarded
+			if err := view.Mkdir("/d", 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := view.Rename("/d", "/e"); err != nil {
+				t.Fatal(err)
+			}
+			w, err := view.Create("/e/log")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.WriteString("one "); err != nil {
+				t.Fatal(err)
+			}
+			if n := sw.OpenWriters(); n != 1 {
+				t.Errorf("OpenWriters: got %d, want 1", n)
+			}
+
+			sw.Lock()
+			if !sw.Locked() {
+				t.Fatal("Lock did not lock")
+			}
+
+			// locked: new writes are denied, through every view
+			if _, err := view.Create("/e/other"); !errors.Is(err, rofs.ErrReadOnly) {
+				t.Errorf("Create while locked: got %v", err)
+			}
+			if err := sw.MkdirAll(path.Join(dir, "x"), 0755); !errors.Is(err, rofs.ErrReadOnly) {
+				t.Errorf("MkdirAll while locked: got %v", err)
+			}
+			if err := view.Rename("/e", "/f"); !errors.Is(err, rofs.ErrReadOnly) {
+				t.Errorf("Rename while locked: got %v", err)
+			}
+
+			// so are writes through a file opened before the lock
+			if _, err := w.WriteString("two"); !errors.Is(err, rofs.ErrReadOnly) {
+				t.Errorf("WriteString on existing writer while locked: got %v", err)
+			}
+			if _, err := w.WriteAt([]byte("two"), 0); !errors.Is(err, rofs.ErrReadOnly) {
+				t.Errorf("WriteAt on existing writer while locked: got %v", err)
+			}
+			if err := w.Truncate(0); !errors.Is(err, rofs.ErrReadOnly) {
+				t.Errorf("Truncate on existing writer while locked: got %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			if err := sw.LockAndDrain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("LockAndDrain with open writer: got %v", err)
+			}
+
+			drained := make(chan error)
+			go func() { drained <- sw.LockAndDrain(context.Background()) }()
+			select {
+			case err := <-drained:
+				t.Fatalf("LockAndDrain returned before Close: %v", err)
+			case <-time.After(10 * time.Millisecond):
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err := <-drained; err != nil {
+				t.Errorf("LockAndDrain after Close: %v", err)
+			}
+			w.Close() // a second Close must not release the writer again
+			if n := sw.OpenWriters(); n != 0 {
+				t.Errorf("OpenWriters after Close: got %d, want 0", n)
+			}
+			data, err := ioutil.ReadFile(b.fs, path.Join(dir, "e", "log"))
+			if err != nil || string(data) != "one " {
+				t.Errorf("backend content: got %q, %v", data, err)
+			}
+
+			sw.Unlock()
+			if err := view.Remove("/e/log"); err != nil {
+				t.Errorf("Remove after Unlock: %v", err)
+			}
+
+			// writes through an open file resume after Unlock
+			w, err = view.Create("/e/again")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+			sw.Lock()
+			if _, err := w.Write([]byte("x")); !errors.Is(err, rofs.ErrReadOnly) {
+				t.Errorf("Write while locked: got %v", err)
+			}
+			sw.Unlock()
+			if _, err := w.Write([]byte("x")); err != nil {
+				t.Errorf("Write after Unlock: %v", err)
+			}
+		})
+	}
+}
+
+func TestSwitchDrainIgnoresWritable(t *testing.T) {
+	mfs, err := memfs.NewFS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustMkdirAll(t, mfs, "/out")
+	sw, err := rofs.NewSwitch(mfs, rofs.WithWritable("out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := sw.Create("/out/before")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer before.Close()
+	sw.Lock()
+	after, err := sw.Create("/out/after")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer after.Close()
+	if n := sw.OpenWriters(); n != 0 {
+		t.Errorf("OpenWriters: got %d, want 0", n)
+	}
+
+	// files in a writable subtree are not affected by the lock
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := sw.LockAndDrain(ctx); err != nil {
+		t.Errorf("LockAndDrain: %v", err)
+	}
+	if _, err := before.WriteString("x"); err != nil {
+		t.Errorf("Write in writable subtree while locked: %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package rofs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// SymlinkPolicy controls how a FileSystem follows symbolic links.
+type SymlinkPolicy int
+
+const (
+	// SymlinkFollow leaves symlink resolution to the wrapped filesystem, which
+	// follows links wherever they point. This is the default.
+	SymlinkFollow SymlinkPolicy = iota
+
+	// SymlinkConfine makes rofs resolve links itself and follow a link only if
+	// its target stays inside the root of the view. Links that would escape
+	// fail with ErrSymlinkEscape.
+	SymlinkConfine
+
+	// SymlinkNever refuses to follow any symbolic link. Operations that would
+	// have to traverse one fail with syscall.ELOOP; Lstat and Readlink still
+	// work on the link itself.
+	SymlinkNever
+)
+
+// DefaultMaxSymlinkHops is the number of symbolic links rofs expands while
+// resolving one path before failing with syscall.ELOOP.
+const DefaultMaxSymlinkHops = 40
+
+// ErrSymlinkEscape is returned, wrapped in a *fs.PathError, when a symbolic
+// link points outside the root of a view using SymlinkConfine.
+var ErrSymlinkEscape = errors.New("symlink escapes root")
+
+func (p SymlinkPolicy) String() string {
+	switch p {
+	case SymlinkFollow:
+		return "follow"
+	case SymlinkConfine:
+		return "confine"
+	case SymlinkNever:
+		return "never"
+	}
+	return "SymlinkPolicy(" + strconv.Itoa(int(p)) + ")"
+}
+
+// lookup maps name to a path on the wrapped filesystem. Under SymlinkFollow
+// this is a plain path translation. Otherwise every symbolic link on the way
+// is expanded by rofs according to the policy, so the returned path contains
+// no links except, when followLast is false, the final component.
+func (f *FileSystem) lookup(op, name string, followLast bool) (string, error) {
+	return f.resolve(op, name, followLast, f.opts.symlinks)
+}
+
+// resolve is lookup with an explicit policy.
+func (f *FileSystem) resolve(op, name string, followLast bool, policy SymlinkPolicy) (string, error) {
+	if policy == SymlinkFollow {
+		return f.real(name), nil
+	}
+
+	resolved := "/"
+	rest := split(f.abs(name))
+	hops := 0
+	seen := make(map[string]bool)
+
+	for len(rest) > 0 {
+		elem := rest[0]
+		rest = rest[1:]
+		next := path.Join(resolved, elem)
+		if elem == "." || elem == ".." || (len(rest) == 0 && !followLast) {
+			resolved = next
+			continue
+		}
+
+		info, err := f.fs.Lstat(path.Join(f.root, next))
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			// Missing components are left for the wrapped filesystem to
+			// report with its usual error.
+			resolved = next
+			continue
+		}
+
+		if policy == SymlinkNever {
+			return "", &fs.PathError{Op: op, Path: name, Err: syscall.ELOOP}
+		}
+		hops++
+		key := next + "\x00" + strings.Join(rest, "/")
+		if hops > f.opts.maxHops || seen[key] {
+			return "", &fs.PathError{Op: op, Path: name, Err: syscall.ELOOP}
+		}
+		seen[key] = true
+
+		target, err := f.fs.Readlink(path.Join(f.root, next))
+		if err != nil {
+			return "", &fs.PathError{Op: op, Path: name, Err: underlying(err)}
+		}
+
+		if path.IsAbs(target) {
+			// Absolute targets are paths on the wrapped filesystem.
+			target = path.Clean(target)
+			switch {
+			case f.root == "/":
+			case target == f.root:
+				target = "/"
+			case strings.HasPrefix(target, f.root+"/"):
+				target = target[len(f.root):]
+			default:
+				return "", &fs.PathError{Op: op, Path: name, Err: ErrSymlinkEscape}
+			}
+			resolved = "/"
+		} else if escapes(resolved, target) {
+			return "", &fs.PathError{Op: op, Path: name, Err: ErrSymlinkEscape}
+		}
+		rest = append(split(target), rest...)
+	}
+
+	return path.Join(f.root, resolved), nil
+}
+
+// expand resolves name to a path on the wrapped filesystem containing no
+// symbolic links except, when followLast is false, the final component. It
+// follows links the way the wrapped filesystem does under SymlinkFollow:
+// absolute targets are paths on the wrapped filesystem and targets may lie
+// outside the root of the view.
+func (f *FileSystem) expand(op, name string, followLast bool) (string, error) {
+	resolved := "/"
+	rest := split(f.real(name))
+	hops := 0
+
+	for len(rest) > 0 {
+		elem := rest[0]
+		rest = rest[1:]
+		next := path.Join(resolved, elem)
+		if elem == "." || elem == ".." || (len(rest) == 0 && !followLast) {
+			resolved = next
+			continue
+		}
+
+		info, err := f.fs.Lstat(next)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		hops++
+		if hops > f.opts.maxHops {
+			return "", &fs.PathError{Op: op, Path: name, Err: syscall.ELOOP}
+		}
+		target, err := f.fs.Readlink(next)
+		if err != nil {
+			return "", &fs.PathError{Op: op, Path: name, Err: underlying(err)}
+		}
+		if path.IsAbs(target) {
+			resolved = "/"
+		}
+		rest = append(split(target), rest...)
+	}
+
+	return resolved, nil
+}
+
+// escapes reports whether following the relative link target from dir would
+// climb above the root of the view.
+func escapes(dir, target string) bool {
+	depth := len(split(dir))
+	for _, elem := range split(target) {
+		switch elem {
+		case ".":
+		case "..":
+			depth--
+			if depth < 0 {
+				return true
+			}
+		default:
+			depth++
+		}
+	}
+	return false
+}
+
+// split returns the non-empty elements of a slash separated path.
+func split(name string) []string {
+	var elems []string
+	for _, elem := range strings.Split(name, "/") {
+		if elem != "" {
+			elems = append(elems, elem)
+		}
+	}
+	return elems
+}
@@ -0,0 +1,200 @@
+package rofs_test
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"syscall"
+	"testing"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/ioutil"
+	"github.com/absfs/rofs"
+)
+
+func TestSymlinkPolicy(t *testing.T) {
+	for _, b := range testBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			sandbox := path.Join(b.dir, "sandbox")
+			secret := path.Join(b.dir, "secret.txt")
+			mustMkdirAll(t, b.fs, path.Join(sandbox, "dir"))
+			mustWrite(t, b.fs, secret, "top secret")
+			mustWrite(t, b.fs, path.Join(sandbox, "file.txt"), "inside")
+			mustWrite(t, b.fs, path.Join(sandbox, "dir", "nested.txt"), "nested")
+
+			links := map[string]string{
+				"abs-inside":  path.Join(sandbox, "file.txt"),
+				"rel-inside":  "file.txt",
+				"dir-link":    "dir",
+				"up-inside":   "dir/../file.txt",
+				"abs-escape":  secret,
+				"rel-escape":  "../secret.txt",
+				"loop-a":      "loop-b",
+				"loop-b":      "loop-a",
+				"chain":       "rel-inside",
+				"dir/up-link": "../file.txt",
+			}
+			for name, target := range links {
+				if err := b.fs.Symlink(target, path.Join(sandbox, name)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			root, err := rofs.NewFS(b.fs, rofs.WithSymlinkPolicy(rofs.SymlinkConfine))
+			if err != nil {
+				t.Fatal(err)
+			}
+			confined, err := root.SubFS(sandbox)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			t.Run("confine follows links inside the root", func(t *testing.T) {
+				for name, want := range map[string]string{
+					"/abs-inside":          "inside",
+					"/rel-inside":          "inside",
+					"/up-inside":           "inside",
+					"/chain":               "inside",
+					"/dir-link/nested.txt": "nested",
+					"/dir/up-link":         "inside",
+				} {
+					data, err := confined.ReadFile(name)
+					if err != nil {
+						t.Errorf("ReadFile(%s): unexpected error %v", name, err)
+						continue
+					}
+					if string(data) != want {
+						t.Errorf("ReadFile(%s): expected %q, got %q", name, want, data)
+					}
+				}
+
+				f, err := confined.Open("/rel-inside")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.Close()
+				if f.Name() != "/rel-inside" {
+					t.Errorf("Name: expected '/rel-inside', got %q", f.Name())
+				}
+			})
+
+			t.Run("confine rejects links that escape", func(t *testing.T) {
+				for _, name := range []string{"/abs-escape", "/rel-escape"} {
+					if _, err := confined.ReadFile(name); !errors.Is(err, rofs.ErrSymlinkEscape) {
+						t.Errorf("ReadFile(%s): expected ErrSymlinkEscape, got %v", name, err)
+					}
+					if _, err := confined.Stat(name); !errors.Is(err, rofs.ErrSymlinkEscape) {
+						t.Errorf("Stat(%s): expected ErrSymlinkEscape, got %v", name, err)
+					}
+					if _, err := confined.Open(name); !errors.Is(err, rofs.ErrSymlinkEscape) {
+						t.Errorf("Open(%s): expected ErrSymlinkEscape, got %v", name, err)
+					}
+				}
+			})
+
+			t.Run("confine still reads the links themselves", func(t *testing.T) {
+				target, err := confined.Readlink("/abs-escape")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if target != secret {
+					t.Errorf("Readlink: expected %q, got %q", secret, target)
+				}
+				info, err := confined.Lstat("/rel-escape")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Mode()&fs.ModeSymlink == 0 {
+					t.Errorf("Lstat: expected symlink, got %s", info.Mode())
+				}
+			})
+
+			t.Run("loops are detected", func(t *testing.T) {
+				if _, err := confined.Stat("/loop-a"); !errors.Is(err, syscall.ELOOP) {
+					t.Errorf("Stat(/loop-a): expected ELOOP, got %v", err)
+				}
+			})
+
+			t.Run("hop limit", func(t *testing.T) {
+				limited, err := rofs.NewFS(b.fs, rofs.WithSymlinkPolicy(rofs.SymlinkConfine), rofs.WithMaxSymlinkHops(1))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := limited.ReadFile(path.Join(sandbox, "rel-inside")); err != nil {
+					t.Errorf("one hop: unexpected error %v", err)
+				}
+				if _, err := limited.ReadFile(path.Join(sandbox, "chain")); !errors.Is(err, syscall.ELOOP) {
+					t.Errorf("two hops: expected ELOOP, got %v", err)
+				}
+			})
+
+			t.Run("never refuses to follow", func(t *testing.T) {
+				never, err := rofs.NewFS(b.fs, rofs.WithSymlinkPolicy(rofs.SymlinkNever))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := never.ReadFile(path.Join(sandbox, "rel-inside")); !errors.Is(err, syscall.ELOOP) {
+					t.Errorf("ReadFile through link: expected ELOOP, got %v", err)
+				}
+				if _, err := never.Stat(path.Join(sandbox, "dir-link", "nested.txt")); !errors.Is(err, syscall.ELOOP) {
+					t.Errorf("Stat through directory link: expected ELOOP, got %v", err)
+				}
+				if _, err := never.Lstat(path.Join(sandbox, "rel-inside")); err != nil {
+					t.Errorf("Lstat: unexpected error %v", err)
+				}
+				if _, err := never.Readlink(path.Join(sandbox, "rel-inside")); err != nil {
+					t.Errorf("Readlink: unexpected error %v", err)
+				}
+				data, err := never.ReadFile(path.Join(sandbox, "file.txt"))
+				if err != nil || string(data) != "inside" {
+					t.Errorf("ReadFile regular file: got %q, %v", data, err)
+				}
+			})
+
+			t.Run("follow delegates to the backend", func(t *testing.T) {
+				follow, err := rofs.NewFS(b.fs)
+				if err != nil {
+					t.Fatal(err)
+				}
+				sub, err := follow.SubFS(sandbox)
+				if err != nil {
+					t.Fatal(err)
+				}
+				data, err := sub.ReadFile("/abs-escape")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != "top secret" {
+					t.Errorf("ReadFile: expected 'top secret', got %q", data)
+				}
+			})
+		})
+	}
+}
+
+func TestSymlinkPolicyString(t *testing.T) {
+	for p, want := range map[rofs.SymlinkPolicy]string{
+		rofs.SymlinkFollow:    "follow",
+		rofs.SymlinkConfine:   "confine",
+		rofs.SymlinkNever:     "never",
+		rofs.SymlinkPolicy(9): "SymlinkPolicy(9)",
+	} {
+		if got := p.String(); got != want {
+			t.Errorf("String: expected %q, got %q", want, got)
+		}
+	}
+}
+
+func mustMkdirAll(t *testing.T, fs absfs.FileSystem, name string) {
+	t.Helper()
+	if err := fs.MkdirAll(name, 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustWrite(t *testing.T, fs absfs.FileSystem, name, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile(fs, name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,158 @@
+package rofs
+
+import (
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// WithWritable makes the subtrees rooted at dirs writable. Inside them every
+// mutating operation is forwarded to the wrapped filesystem; everywhere else
+// it fails with ErrReadOnly. Operations that span both, such as renaming a
+// file out of a writable subtree, are rejected.
+//
+// Directories are anchored at the root of the view they are given to, and all
+// paths are cleaned before they are checked, so "out/../src" is treated as
+// "src". Symbolic links on the way to a written path are resolved by rofs
+// under SymlinkConfine even if the view uses SymlinkFollow, and the resolved
+// path must lie in a writable subtree as well.
+func WithWritable(dirs ...string) Option {
+	return func(o *options) {
+		o.pendingWritable = append(o.pendingWritable, dirs...)
+	}
+}
+
+// inWritable reports whether real, a path on the wrapped filesystem, lies in
+// a writable or append-only subtree.
+func (f *FileSystem) inWritable(real string) bool {
+	return inTree(f.opts.writable, real) || inTree(f.opts.appendOnly, real)
+}
+
+// inTree reports whether real lies in one of the subtrees rooted at dirs.
+func inTree(dirs []string, real string) bool {
+	for _, dir := range dirs {
+		if real == dir || dir == "/" || strings.HasPrefix(real, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// nop is the release function returned by writePath when there is nothing
+// to release.
+func nop() {}
+
+// writePath decides whether the mutating operation op, which needs the
+// capabilities need outside the writable subtrees, may be applied to name.
+// It returns the path on the wrapped filesystem to forward the operation to
+// and a function the caller must call once the operation has completed, or
+// the error to report.
+func (f *FileSystem) writePath(op string, need Capability, name string, followLast bool) (string, func(), error) {
+	done, err := f.beginWrite(op, name)
+	if err != nil {
+		return "", nil, err
+	}
+	real, err := f.checkWrite(op, need, name, followLast)
+	if err != nil {
+		done()
+		return "", nil, err
+	}
+	return real, done, nil
+}
+
+// writePaths is writePath for operations on two paths. Both must be writable;
+// otherwise the error is a *os.LinkError.
+func (f *FileSystem) writePaths(op string, need Capability, oldname, newname string) (string, string, func(), error) {
+	done, err := f.beginWrite(op, oldname)
+	if err == nil {
+		var oldreal, newreal string
+		oldreal, err = f.checkWrite(op, need, oldname, false)
+		if err == nil {
+			newreal, err = f.checkWrite(op, need, newname, false)
+			if err == nil {
+				return oldreal, newreal, done, nil
+			}
+		}
+		done()
+	}
+	return "", "", nil, &os.LinkError{Op: op, Old: oldname, New: newname, Err: underlying(err)}
+}
+
+// beginWrite marks the start of a mutating operation on name, waiting first
+// if the view belongs to a frozen Freezer. It returns the function that marks
+// the end of the operation.
+func (f *FileSystem) beginWrite(op, name string) (func(), error) {
+	switch {
+	case f.fz != nil:
+		if err := f.fz.enter(f.Context(), op, name); err != nil {
+			return nil, err
+		}
+		return f.fz.exit, nil
+	case f.sw != nil:
+		f.sw.mu.RLock()
+		return f.sw.mu.RUnlock, nil
+	}
+	return nop, nil
+}
+
+// forwardAll reports whether the view forwards every mutating operation
+// instead of only those inside its writable subtrees.
+func (f *FileSystem) forwardAll() bool {
+	return f.fz != nil || f.ov != nil || f.sw != nil && !f.sw.locked
+}
+
+// checkWrite implements writePath. Unless the view forwards every operation
+// or grants need, paths outside every writable subtree are refused without
+// consulting the wrapped filesystem.
+func (f *FileSystem) checkWrite(op string, need Capability, name string, followLast bool) (string, error) {
+	lexical := f.real(name)
+	var real string
+	if f.forwardAll() {
+		var err error
+		if real, err = f.locate(op, name, followLast); err != nil {
+			return "", err
+		}
+		if f.opts.symlinks == SymlinkFollow {
+			// check, and forward the operation to, the path the wrapped
+			// filesystem would resolve the links to
+			if real, err = f.expand(op, name, followLast); err != nil {
+				return "", err
+			}
+		}
+	} else {
+		granted := f.granted(need)
+		if !granted && !f.inWritable(lexical) {
+			return "", readOnly(op, name)
+		}
+
+		policy := f.opts.symlinks
+		if policy == SymlinkFollow {
+			policy = SymlinkConfine
+		}
+		var err error
+		real, err = f.resolve(op, name, followLast, policy)
+		if err != nil {
+			return "", err
+		}
+		if len(f.opts.rules) > 0 && (f.hidden(lexical) || f.hidden(real)) {
+			return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		if !granted && !f.inWritable(real) {
+			return "", readOnly(op, name)
+		}
+	}
+
+	if !appendAllowed(op) && f.appendOnly(lexical, real) {
+		return "", appendOnly(op, name)
+	}
+	if (op == "rename" || op == "remove" || op == "removeall") && f.holdsAppendOnly(lexical, real) {
+		return "", appendOnly(op, name)
+	}
+	if err := f.retained(op, name, real); err != nil {
+		return "", err
+	}
+	if err := f.checkSealed(op, name, real); err != nil {
+		return "", err
+	}
+	return real, nil
+}
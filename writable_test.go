@@ -0,0 +1,195 @@
+package rofs_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/absfs/ioutil"
+	"github.com/absfs/rofs"
+)
+
+func TestWritable(t *testing.T) {
+	for _, b := range testBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			repo := path.Join(b.dir, "repo")
+			for _, dir := range []string{"src", "out", "tmp"} {
+				mustMkdirAll(t, b.fs, path.Join(repo, dir))
+			}
+			mustWrite(t, b.fs, path.Join(repo, "src", "main.go"), "package main")
+			mustWrite(t, b.fs, path.Join(repo, "out", "old.o"), "object")
+			if err := b.fs.Symlink("../src", path.Join(repo, "out", "escape")); err != nil {
+				t.Fatal(err)
+			}
+
+			rfs, err := rofs.NewFS(b.fs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			view, err := rfs.SubFS(repo, rofs.WithWritable("out", "/tmp"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := snapshot(t, b.fs, path.Join(repo, "src"))
+
+			t.Run("writes inside carve-outs are forwarded", func(t *testing.T) {
+				f, err := view.Create("/out/bin")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := f.WriteString("binary"); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := f.WriteAt([]byte("B"), 0); err != nil {
+					t.Fatal(err)
+				}
+				if err := f.Sync(); err != nil {
+					t.Fatal(err)
+				}
+				if err := f.Close(); err != nil {
+					t.Fatal(err)
+				}
+				data, err := ioutil.ReadFile(b.fs, path.Join(repo, "out", "bin"))
+				if err != nil || string(data) != "Binary" {
+					t.Errorf("backend content: got %q, %v", data, err)
+				}
+
+				if err := view.MkdirAll("tmp/a/b", 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := view.Mkdir("/tmp/c", 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := view.Chmod("/out/bin", 0600); err != nil {
+					t.Fatal(err)
+				}
+				if err := view.Chtimes("/out/bin", time.Now(), time.Now()); err != nil {
+					t.Fatal(err)
+				}
+				if err := view.Truncate("/out/bin", 3); err != nil {
+					t.Fatal(err)
+				}
+				if err := view.Rename("/out/bin", "/tmp/bin"); err != nil {
+					t.Fatal(err)
+				}
+				if err := view.Remove("/out/old.o"); err != nil {
+					t.Fatal(err)
+				}
+				if err := view.Symlink("bin", "/tmp/link"); err != nil {
+					t.Fatal(err)
+				}
+				if err := view.RemoveAll("/tmp/a"); err != nil {
+					t.Fatal(err)
+				}
+
+				data, err = view.ReadFile("/tmp/link")
+				if err != nil || string(data) != "Bin" {
+					t.Errorf("ReadFile: got %q, %v", data, err)
+				}
+				if _, err := b.fs.Stat(path.Join(repo, "tmp", "a")); !errors.Is(err, fs.ErrNotExist) {
+					t.Errorf("RemoveAll: expected tmp/a to be gone, got %v", err)
+				}
+			})
+
+			t.Run("writes elsewhere are denied", func(t *testing.T) {
+				ops := map[string]error{
+					"Create":   func() error { _, err := view.Create("/src/new.go"); return err }(),
+					"OpenFile": func() error { _, err := view.OpenFile("/src/main.go", os.O_RDWR, 0); return err }(),
+					"Mkdir":    view.Mkdir("/src/pkg", 0755),
+					"Remove":   view.Remove("/src/main.go"),
+					"Chmod":    view.Chmod("/src/main.go", 0600),
+					"Truncate": view.Truncate("/src/main.go", 0),
+					"Root":     view.Mkdir("/new", 0755),
+				}
+				for op, err := range ops {
+					if !errors.Is(err, rofs.ErrReadOnly) {
+						t.Errorf("%s: expected ErrReadOnly, got %v", op, err)
+					}
+				}
+			})
+
+			t.Run("cross-boundary renames are rejected", func(t *testing.T) {
+				mustWrite(t, b.fs, path.Join(repo, "out", "move.o"), "x")
+				for _, pair := range [][2]string{
+					{"/out/move.o", "/src/move.o"},
+					{"/src/main.go", "/out/main.go"},
+				} {
+					err := view.Rename(pair[0], pair[1])
+					var linkErr *os.LinkError
+					if !errors.As(err, &linkErr) {
+						t.Fatalf("Rename(%s, %s): expected *os.LinkError, got %T %v", pair[0], pair[1], err, err)
+					}
+					if !errors.Is(err, rofs.ErrReadOnly) {
+						t.Errorf("Rename(%s, %s): expected ErrReadOnly, got %v", pair[0], pair[1], err)
+					}
+				}
+			})
+
+			t.Run("paths are canonicalized", func(t *testing.T) {
+				for _, name := range []string{"out/../src/main.go", "/out/../src/x", "/tmp/../../src/main.go"} {
+					if _, err := view.Create(name); !errors.Is(err, rofs.ErrReadOnly) {
+						t.Errorf("Create(%s): expected ErrReadOnly, got %v", name, err)
+					}
+				}
+				if err := view.Chdir("/out"); err != nil {
+					t.Fatal(err)
+				}
+				if err := view.Remove("../src/main.go"); !errors.Is(err, rofs.ErrReadOnly) {
+					t.Errorf("relative Remove: expected ErrReadOnly, got %v", err)
+				}
+				f, err := view.Create("relative.txt")
+				if err != nil {
+					t.Fatalf("relative Create: %v", err)
+				}
+				f.Close()
+			})
+
+			t.Run("symlinks cannot carry writes out", func(t *testing.T) {
+				if _, err := view.Create("/out/escape/evil.go"); !errors.Is(err, rofs.ErrReadOnly) {
+					t.Errorf("Create through link: expected ErrReadOnly, got %v", err)
+				}
+				if err := view.Chmod("/out/escape", 0777); !errors.Is(err, rofs.ErrReadOnly) {
+					t.Errorf("Chmod through link: expected ErrReadOnly, got %v", err)
+				}
+				// The link itself lives in out/ and may be removed.
+				if err := view.Remove("/out/escape"); err != nil {
+					t.Errorf("Remove link: unexpected error %v", err)
+				}
+			})
+
+			t.Run("read-only files stay read-only in carve-outs", func(t *testing.T) {
+				mustWrite(t, b.fs, path.Join(repo, "out", "ro.txt"), "ro")
+				f, err := view.Open("/out/ro.txt")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.Close()
+				if _, err := f.Write([]byte("x")); !errors.Is(err, rofs.ErrReadOnly) {
+					t.Errorf("Write: expected ErrReadOnly, got %v", err)
+				}
+			})
+
+			after := snapshot(t, b.fs, path.Join(repo, "src"))
+			if len(before) != len(after) || before["main.go"] != after["main.go"] {
+				t.Errorf("src changed:\nbefore: %v\nafter:  %v", before, after)
+			}
+		})
+	}
+}
+
+func TestWritableRespectsRules(t *testing.T) {
+	rfs, wfs := setupTestFS(t)
+	view, err := rfs.SubFS("/testdir", rofs.WithWritable("subdir"), rofs.WithRules(rofs.Deny("**/*.key")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := view.Create("/subdir/server.key"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Create hidden: expected fs.ErrNotExist, got %v", err)
+	}
+	if _, err := wfs.Stat("/testdir/subdir/server.key"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("hidden file was created: %v", err)
+	}
+}